@@ -115,6 +115,16 @@ else
 fi
 cd ..
 
+# 设置了 MINISIGN_SECRET_KEY 时用 minisign 为各平台的可执行文件生成签名，
+# 客户端配置 artifact_public_keys 后会校验这些签名
+if [ -n "$MINISIGN_SECRET_KEY" ]; then
+    echo "=========================="
+    echo "生成 minisign 签名..."
+    for file in build/download_allinone_*_${VERSION}; do
+        minisign -S -s "$MINISIGN_SECRET_KEY" -m "$file" -t "$(basename "$file") v${VERSION}" || exit 1
+    done
+fi
+
 # 创建发布包
 echo "=========================="
 echo "创建发布包..."
@@ -159,7 +169,7 @@ RELEASE_NOTES=$(cat << EOF
 {
     "tag_name": "v${VERSION}",
     "name": "Release v${VERSION}",
-    "body": "# Release v${VERSION}\n\n---\n\n## 更新内容\n\n${CUSTOM_MESSAGE}\n\n---\n\n## 构建信息\n\n- 发布时间：${FORMATTED_DATE}\n- SHA256 校验和：请参考压缩包中的 \`SHA256SUMS.txt\` 文件\n",
+    "body": "# Release v${VERSION}\n\n---\n\n## 更新内容\n\n${CUSTOM_MESSAGE}\n\n---\n\n## 构建信息\n\n- 发布时间：${FORMATTED_DATE}\n- SHA256 校验和：请参考附件和压缩包中的 \`SHA256SUMS.txt\` 文件\n",
     "draft": false,
     "prerelease": false
 }
@@ -194,6 +204,19 @@ curl -H "Authorization: token ${GITHUB_TOKEN}" \
     --data-binary @"${ZIP_NAME}" \
     "https://uploads.github.com/repos/${GITHUB_REPO}/releases/${RELEASE_ID}/assets?name=${ZIP_NAME}"
 
+# 逐个上传各平台的可执行文件、摘要文件和签名，供 github 更新源按附件名称识别平台并校验
+echo "上传各平台可执行文件..."
+for file in build/download_allinone_*_${VERSION} build/download_allinone_*_${VERSION}.minisig build/SHA256SUMS.txt; do
+    [ -f "$file" ] || continue
+    ASSET_NAME=$(basename "$file")
+    echo "上传 ${ASSET_NAME}..."
+    curl -H "Authorization: token ${GITHUB_TOKEN}" \
+        -H "Content-Type: application/octet-stream" \
+        -H "Accept: application/vnd.github.v3+json" \
+        --data-binary @"${file}" \
+        "https://uploads.github.com/repos/${GITHUB_REPO}/releases/${RELEASE_ID}/assets?name=${ASSET_NAME}"
+done
+
 echo "=========================="
 echo "发布完成！"
 echo "请访问 https://github.com/${GITHUB_REPO}/releases/tag/v${VERSION} 查看"
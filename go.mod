@@ -1,3 +1,12 @@
 module go_auto_download
 
 go 1.21 // 或者您使用的 Go 版本
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/kr/binarydist v0.1.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.24.0
+	golang.org/x/sys v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,77 +1,163 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"go_auto_download/pkg/updater"
 	"log"
 	"os"
+	"path/filepath"
 )
 
-func Logf(s string, err error) {
-	updater.Logf(s, err)
-}
-
 func main() {
+	loader := updater.NewConfigLoader()
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	loader.RegisterFlags(fs)
+	submitVersion := fs.String("v", "", "提交版本号到服务器（语义化版本号，如 1.2.0 或 1.2.0-beta.1）")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: %s [参数] [check-config | channel [stable|beta|nightly] | make-patch <旧版本号> <旧文件> <新文件> <补丁文件>]\n\n参数:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	// 生成差分补丁：不需要加载配置
+	if fs.Arg(0) == "make-patch" {
+		os.Exit(makePatch(fs.Args()[1:]))
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 检查配置模式：打印生效的配置并校验
+	if fs.Arg(0) == "check-config" {
+		path, _ := loader.ConfigPath()
+		fmt.Printf("配置文件: %s\n", path)
+		os.Exit(checkConfig(cfg))
+	}
+
 	// 先初始化日志
-	if err := updater.InitLogger(); err != nil {
+	logger := updater.NewLogManager(cfg.LogDir)
+	if err := logger.Init(); err != nil {
 		log.Printf("初始化日志失败: %v", err)
 		return
 	}
+	defer logger.Close()
 
-	// 检查是否是版本查询模式
-	if len(os.Args) > 1 && os.Args[1] == "-v" {
-		if len(os.Args) < 3 {
-			log.Fatalf("请提供版本号参数")
-			return
-		}
+	u, err := updater.New(cfg, updater.WithLogger(logger))
+	if err != nil {
+		log.Fatalf("创建更新器失败: %v", err)
+	}
+
+	// 查看或切换发布频道
+	if fs.Arg(0) == "channel" {
+		code := switchChannel(u, fs.Arg(1))
+		logger.Close()
+		os.Exit(code)
+	}
 
-		版本 := os.Args[2]
+	// 检查是否是版本查询模式
+	if *submitVersion != "" {
+		版本 := *submitVersion
 		// 验证版本号格式
 		if !updater.IsValidVersion(版本) {
-			log.Fatalf("无效的版本号格式，请使用 x.y.z 格式（如：1.0.0）")
+			log.Fatalf("无效的版本号格式，请使用语义化版本号（如：1.0.0、1.2.0-beta.1）")
 			return
 		}
 
 		// 限制版本号长度
-		if len(版本) > 20 {
+		if len(版本) > 64 {
 			log.Fatalf("版本号过长")
 			return
 		}
 
 		// 执行版本查询
-		if err := updater.SubmitVersion(版本); err != nil {
+		if err := u.SubmitVersion(版本); err != nil {
 			log.Fatalf("版本查询失败: %v", err)
 		}
 		return
 	}
 
 	// 先检查并关闭旧进程
-	if err := updater.StopProcessByName(); err != nil {
-		Logf("关闭旧进程失败: %v", err)
+	if err := u.StopProcessByName(); err != nil {
+		logger.Logf("关闭旧进程失败: %v", err)
 	}
 
+	// 收到 SIGHUP 或配置文件变化时重新加载配置，不重启服务
+	go u.WatchConfig(loader)
+
 	// 正常更新检查逻辑
-	if err := run(); err != nil {
-		Logf("程序运行错误: %v", err)
+	if err := run(u, logger); err != nil {
+		logger.Logf("程序运行错误: %v", err)
 		os.Exit(1)
 	}
 }
 
 // run 封装主要的运行逻辑
-func run() error {
-	// 初始化日志
-	if err := updater.InitLogger(); err != nil {
-		return fmt.Errorf("初始化日志失败: %v", err)
+func run(u *updater.Updater, logger *updater.LogManager) error {
+	// 记录启动信息
+	logger.LogStartupInfo()
+
+	// 首次立即检查，之后定时检查更新
+	return u.Run()
+}
+
+// checkConfig 打印生效的配置（隐藏密钥）并输出校验结果，返回进程退出码
+func checkConfig(cfg updater.Config) int {
+	data, err := json.MarshalIndent(cfg.Redacted(), "", "    ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "序列化配置失败: %v\n", err)
+		return 1
 	}
+	fmt.Println(string(data))
 
-	// 记录启动信息
-	updater.LogStartupInfo()
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "配置校验失败:\n%v\n", err)
+		return 1
+	}
+	fmt.Println("配置校验通过")
+	return 0
+}
+
+// switchChannel 不带参数时打印当前发布频道，否则切换到指定频道，返回进程退出码
+func switchChannel(u *updater.Updater, channel string) int {
+	if channel == "" {
+		fmt.Println(u.Channel())
+		return 0
+	}
+	if err := u.SetChannel(channel); err != nil {
+		fmt.Fprintf(os.Stderr, "切换发布频道失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已切换到 %s 频道，下次检查更新时生效\n", channel)
+	return 0
+}
 
-	// 首次运行立即检查
-	if err := updater.CheckAndUpdate(); err != nil {
-		Logf("首次更新检查失败: %v", err)
+// makePatch 生成从旧文件到新文件的差分补丁，打印可以填入版本信息 patches 的内容，返回进程退出码
+func makePatch(args []string) int {
+	if len(args) != 4 {
+		fmt.Fprintf(os.Stderr, "用法: %s make-patch <旧版本号> <旧文件> <新文件> <补丁文件>\n", os.Args[0])
+		return 2
+	}
+	if !updater.IsValidVersion(args[0]) {
+		fmt.Fprintf(os.Stderr, "无效的版本号: %s\n", args[0])
+		return 2
 	}
+	patch, err := updater.GeneratePatch(args[1], args[2], args[3])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "生成差分补丁失败: %v\n", err)
+		return 1
+	}
+	patch.From = args[0]
+	patch.URL = filepath.Base(args[3])
 
-	// 定时检查更新
-	return updater.StartUpdateChecker()
+	data, err := json.MarshalIndent(patch, "", "    ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "序列化补丁信息失败: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
 }
@@ -0,0 +1,492 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// 制品的压缩包格式
+const (
+	ARCHIVE_TAR_GZ = "tar.gz"
+	ARCHIVE_TAR_XZ = "tar.xz"
+	ARCHIVE_ZIP    = "zip"
+	// ARCHIVE_NONE 制品本身就是可执行文件
+	ARCHIVE_NONE = "binary"
+)
+
+// ARCHIVE_MAX_ENTRIES 压缩包中条目数量的上限
+const ARCHIVE_MAX_ENTRIES = 10000
+
+// RELEASES_KEEP 版本目录中保留的版本数量，包括当前版本
+const RELEASES_KEEP = 3
+
+// errArchiveUnsafe 压缩包中有不安全的条目
+var errArchiveUnsafe = errors.New("压缩包不安全")
+
+// archiveFormat 确定制品的格式：优先使用版本信息中的 format，其次是下载地址的扩展名，
+// 最后根据文件头识别。file 为空时不检查文件头，无法识别时视为单个可执行文件
+func archiveFormat(artifact Artifact, file string) (string, error) {
+	switch artifact.Format {
+	case ARCHIVE_TAR_GZ, ARCHIVE_TAR_XZ, ARCHIVE_ZIP, ARCHIVE_NONE:
+		return artifact.Format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("不支持的制品格式: %s", artifact.Format)
+	}
+
+	name := strings.ToLower(artifact.URL)
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ARCHIVE_TAR_GZ, nil
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return ARCHIVE_TAR_XZ, nil
+	case strings.HasSuffix(name, ".zip"):
+		return ARCHIVE_ZIP, nil
+	}
+	if file == "" {
+		return ARCHIVE_NONE, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 6)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ARCHIVE_TAR_GZ, nil
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return ARCHIVE_TAR_XZ, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return ARCHIVE_ZIP, nil
+	}
+	return ARCHIVE_NONE, nil
+}
+
+// installRelease 将制品和附加文件安装到 releases_dir 下以版本号命名的目录：压缩包解压到该目录，
+// 单个可执行文件放入该目录，附加文件按 files 放置。全部准备好后，
+// 再把程序文件原子地替换为指向其中可执行文件的符号链接
+func (u *Updater) installRelease(src Source, file, format string, artifact Artifact, info *VersionInfo) error {
+	releasesDir := u.path(u.cfg.ReleasesDir)
+	if err := os.MkdirAll(releasesDir, 0755); err != nil {
+		return fmt.Errorf("创建版本目录失败: %v", err)
+	}
+	name := "v" + strings.TrimPrefix(info.Version, "v")
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("版本号 %q 不能用作目录名", info.Version)
+	}
+
+	tmpDir, err := os.MkdirTemp(releasesDir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	executable := artifact.Executable
+	if executable == "" {
+		executable = filepath.Base(u.cfg.LocalFile)
+	}
+	x := &archiveExtractor{dir: tmpDir, maxSize: u.cfg.ArchiveMaxSize, symlinks: map[string]bool{}}
+	exePath, err := x.safePath(executable)
+	if err != nil {
+		return fmt.Errorf("可执行文件路径 %q 无效: %v", executable, err)
+	}
+
+	if format == ARCHIVE_NONE {
+		if err := os.MkdirAll(filepath.Dir(exePath), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(file, exePath); err != nil {
+			return fmt.Errorf("移动可执行文件失败: %v", err)
+		}
+	} else {
+		u.logf("制品为 %s 压缩包，解压安装", format)
+		if err := x.extract(file, format); err != nil {
+			return fmt.Errorf("解压 %s 失败: %w", format, err)
+		}
+		u.logf("已解压 %d 个条目，共 %d 字节", x.entries, x.written)
+	}
+
+	if fi, err := os.Lstat(exePath); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("制品中没有可执行文件 %s", executable)
+	}
+	if err := os.Chmod(exePath, 0755); err != nil {
+		return fmt.Errorf("设置执行权限失败: %v", err)
+	}
+
+	// 先下载并校验全部附加文件，任何一个失败都不修改已安装的版本
+	configs, err := u.stageBundleFiles(src, x, info.Files)
+	defer configs.cleanup()
+	if err != nil {
+		return err
+	}
+	if err := u.prepareConfigFiles(configs); err != nil {
+		return err
+	}
+
+	// 重新安装同一版本时先移走旧目录，替换后再删除
+	target := filepath.Join(releasesDir, name)
+	old := ""
+	if _, err := os.Lstat(target); err == nil {
+		old = tmpDir + ".old"
+		if err := os.Rename(target, old); err != nil {
+			return fmt.Errorf("移走旧的版本目录失败: %v", err)
+		}
+		defer os.RemoveAll(old)
+	}
+	restoreDir := func() {
+		os.RemoveAll(target)
+		if old != "" {
+			os.Rename(old, target)
+		}
+	}
+	if err := os.Rename(tmpDir, target); err != nil {
+		if old != "" {
+			os.Rename(old, target)
+		}
+		return fmt.Errorf("重命名版本目录失败: %v", err)
+	}
+
+	absTarget, err := filepath.Abs(filepath.Join(target, filepath.FromSlash(path.Clean(executable))))
+	if err != nil {
+		restoreDir()
+		return err
+	}
+
+	// 记录替换前的程序文件，提交配置文件失败时恢复
+	local := u.path(u.cfg.LocalFile)
+	prevLink, _ := os.Readlink(local)
+	prevFile := ""
+	if fi, err := os.Lstat(local); err == nil && fi.Mode().IsRegular() {
+		prevFile = local + ".prev"
+		os.Remove(prevFile)
+		if err := os.Link(local, prevFile); err != nil {
+			restoreDir()
+			return fmt.Errorf("备份程序文件失败: %v", err)
+		}
+		defer os.Remove(prevFile)
+	}
+	if err := replaceWithSymlink(absTarget, local); err != nil {
+		restoreDir()
+		return err
+	}
+
+	// 程序文件切换成功后才提交配置文件，失败时恢复原来的程序文件和版本目录
+	if err := configs.commit(); err != nil {
+		switch {
+		case prevLink != "":
+			replaceWithSymlink(prevLink, local)
+		case prevFile != "":
+			os.Rename(prevFile, local)
+		default:
+			os.Remove(local)
+		}
+		restoreDir()
+		return fmt.Errorf("%v，已恢复原来的版本", err)
+	}
+	u.recordConfigFiles(configs)
+	u.logf("已安装到 %s，可执行文件 %s", target, executable)
+
+	u.pruneReleases(releasesDir, name)
+	return nil
+}
+
+// releaseDir 程序文件是指向 releases_dir 中某个版本的符号链接时，返回可执行文件所在的目录
+func (u *Updater) releaseDir(file string) (string, bool) {
+	real, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", false
+	}
+	releases, err := filepath.Abs(u.path(u.cfg.ReleasesDir))
+	if err != nil {
+		return "", false
+	}
+	if releases, err = filepath.EvalSymlinks(releases); err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(releases, real)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return filepath.Dir(real), true
+}
+
+// replaceWithSymlink 原子地将 link 替换为指向 target 的符号链接
+func replaceWithSymlink(target, link string) error {
+	tmp := link + ".link.tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("创建符号链接失败: %v", err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("替换程序文件失败: %v", err)
+	}
+	return nil
+}
+
+// pruneReleases 删除较早的版本目录，保留最近的 RELEASES_KEEP 个版本
+func (u *Updater) pruneReleases(dir, current string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type release struct {
+		name string
+		mod  int64
+	}
+	var releases []release
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == current || strings.HasSuffix(e.Name(), ".tmp") || strings.HasSuffix(e.Name(), ".old") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		releases = append(releases, release{e.Name(), info.ModTime().UnixNano()})
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].mod > releases[j].mod })
+	for i := RELEASES_KEEP - 1; i < len(releases); i++ {
+		if err := os.RemoveAll(filepath.Join(dir, releases[i].name)); err != nil {
+			u.logf("删除旧版本目录 %s 失败: %v", releases[i].name, err)
+			continue
+		}
+		u.logf("已删除旧版本目录 %s", releases[i].name)
+	}
+}
+
+// archiveExtractor 将压缩包安全地解压到 dir：拒绝绝对路径、包含 .. 的路径、
+// 指向目录外的符号链接、经过符号链接写入的条目，以及超过 maxSize 的内容
+type archiveExtractor struct {
+	dir     string
+	maxSize int64
+	written int64
+	entries int
+	// symlinks 已解压的符号链接，之后的条目不能以它们作为上级目录
+	symlinks map[string]bool
+}
+
+// extract 按格式解压文件
+func (x *archiveExtractor) extract(file, format string) error {
+	if format == ARCHIVE_ZIP {
+		return x.extractZip(file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader
+	switch format {
+	case ARCHIVE_TAR_GZ:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case ARCHIVE_TAR_XZ:
+		if r, err = xz.NewReader(f); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的压缩包格式: %s", format)
+	}
+	return x.extractTar(r)
+}
+
+func (x *archiveExtractor) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(hdr.Name)
+		case tar.TypeReg:
+			err = x.file(hdr.Name, hdr.FileInfo().Mode(), hdr.Size, tr)
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			err = fmt.Errorf("%w: 不支持条目 %s 的类型 %q", errArchiveUnsafe, hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x *archiveExtractor) extractZip(file string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(f.Name)
+		case mode&fs.ModeSymlink != 0:
+			err = x.zipSymlink(f)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err == nil {
+				err = x.file(f.Name, mode, int64(f.UncompressedSize64), rc)
+				rc.Close()
+			}
+		default:
+			err = fmt.Errorf("%w: 不支持条目 %s 的类型 %s", errArchiveUnsafe, f.Name, mode.Type())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipSymlink 解压 zip 中的符号链接，链接目标保存在条目内容中
+func (x *archiveExtractor) zipSymlink(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return x.symlink(f.Name, string(target))
+}
+
+// safePath 检查条目名称并返回解压后的路径
+func (x *archiveExtractor) safePath(name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if name == "" || strings.Contains(name, `\`) || !filepath.IsLocal(filepath.FromSlash(clean)) {
+		return "", fmt.Errorf("%w: 条目路径 %q 不在解压目录内", errArchiveUnsafe, name)
+	}
+	for dir := path.Dir(clean); dir != "."; dir = path.Dir(dir) {
+		if x.symlinks[dir] {
+			return "", fmt.Errorf("%w: 条目 %q 位于符号链接 %s 下", errArchiveUnsafe, name, dir)
+		}
+	}
+	return filepath.Join(x.dir, filepath.FromSlash(clean)), nil
+}
+
+// count 统计条目数量
+func (x *archiveExtractor) count() error {
+	x.entries++
+	if x.entries > ARCHIVE_MAX_ENTRIES {
+		return fmt.Errorf("%w: 条目数量超过 %d", errArchiveUnsafe, ARCHIVE_MAX_ENTRIES)
+	}
+	return nil
+}
+
+func (x *archiveExtractor) mkdir(name string) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	p, err := x.safePath(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0755)
+}
+
+// file 解压普通文件。声明的大小和实际读取的内容都不能超过剩余的解压配额
+func (x *archiveExtractor) file(name string, mode fs.FileMode, size int64, r io.Reader) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	p, err := x.safePath(name)
+	if err != nil {
+		return err
+	}
+	remaining := x.maxSize - x.written
+	if size > remaining {
+		return fmt.Errorf("%w: 条目 %s 大小 %d 字节，超过解压上限 %d 字节", errArchiveUnsafe, name, size, x.maxSize)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	// 只保留读写和执行权限，去掉 setuid 等特殊位
+	out, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()&0755|0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	x.written += n
+	if err != nil {
+		return err
+	}
+	if x.written > x.maxSize {
+		return fmt.Errorf("%w: 解压后的内容超过 %d 字节", errArchiveUnsafe, x.maxSize)
+	}
+	return nil
+}
+
+// symlink 创建符号链接，链接目标必须是解压目录内的相对路径
+func (x *archiveExtractor) symlink(name, target string) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	p, err := x.safePath(name)
+	if err != nil {
+		return err
+	}
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if target == "" || path.IsAbs(target) || strings.Contains(target, `\`) {
+		return fmt.Errorf("%w: 符号链接 %s 指向解压目录外的 %s", errArchiveUnsafe, name, target)
+	}
+	// 逐级解析链接目标，不允许经过其他符号链接，否则 .. 可能越过解压目录
+	cur := path.Dir(clean)
+	for _, part := range strings.Split(target, "/") {
+		if x.symlinks[cur] {
+			return fmt.Errorf("%w: 符号链接 %s 的目标 %s 经过了符号链接 %s", errArchiveUnsafe, name, target, cur)
+		}
+		cur = path.Join(cur, part)
+		if !filepath.IsLocal(filepath.FromSlash(cur)) {
+			return fmt.Errorf("%w: 符号链接 %s 指向解压目录外的 %s", errArchiveUnsafe, name, target)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, p); err != nil {
+		return err
+	}
+	x.symlinks[clean] = true
+	return nil
+}
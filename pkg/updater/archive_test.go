@@ -0,0 +1,218 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntry 测试压缩包中的一个条目
+type testEntry struct {
+	name string
+	typ  byte
+	body string
+	link string
+	mode int64
+}
+
+func writeTarGz(t *testing.T, file string, entries []testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typ, Linkname: e.link, Mode: mode, Size: int64(len(e.body))}
+		if e.typ != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.typ == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, file string, entries []testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		switch e.typ {
+		case tar.TypeSymlink:
+			hdr.SetMode(fs.ModeSymlink | 0777)
+			body = e.link
+		case tar.TypeDir:
+			hdr.SetMode(fs.ModeDir | 0755)
+		default:
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// extractTest 在临时目录的 out 子目录中解压，返回解压目录和错误
+func extractTest(t *testing.T, format string, entries []testEntry, maxSize int64) (string, error) {
+	t.Helper()
+	root := t.TempDir()
+	file := filepath.Join(root, "archive")
+	if format == ARCHIVE_ZIP {
+		writeZip(t, file, entries)
+	} else {
+		writeTarGz(t, file, entries)
+	}
+	dir := filepath.Join(root, "out")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	x := &archiveExtractor{dir: dir, maxSize: maxSize, symlinks: map[string]bool{}}
+	return dir, x.extract(file, format)
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{"上级目录", []testEntry{{name: "../evil", typ: tar.TypeReg, body: "x"}}},
+		{"中间的上级目录", []testEntry{{name: "a/../../evil", typ: tar.TypeReg, body: "x"}}},
+		{"绝对路径", []testEntry{{name: "/tmp/evil", typ: tar.TypeReg, body: "x"}}},
+		{"反斜杠", []testEntry{{name: `..\evil`, typ: tar.TypeReg, body: "x"}}},
+		{"符号链接指向上级目录", []testEntry{{name: "l", typ: tar.TypeSymlink, link: "../outside"}}},
+		{"符号链接指向绝对路径", []testEntry{{name: "l", typ: tar.TypeSymlink, link: "/etc"}}},
+		{"符号链接经过其他符号链接", []testEntry{
+			{name: "s", typ: tar.TypeSymlink, link: "."},
+			{name: "e", typ: tar.TypeSymlink, link: "s/.."},
+		}},
+		{"条目位于符号链接下", []testEntry{
+			{name: "d/", typ: tar.TypeDir},
+			{name: "l", typ: tar.TypeSymlink, link: "d"},
+			{name: "l/evil", typ: tar.TypeReg, body: "x"},
+		}},
+		{"硬链接", []testEntry{
+			{name: "a", typ: tar.TypeReg, body: "x"},
+			{name: "b", typ: tar.TypeLink, link: "a"},
+		}},
+		{"设备文件", []testEntry{{name: "dev", typ: tar.TypeChar}}},
+		{"超过解压上限", []testEntry{{name: "big", typ: tar.TypeReg, body: string(make([]byte, 2048))}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := extractTest(t, ARCHIVE_TAR_GZ, c.entries, 1024)
+			if !errors.Is(err, errArchiveUnsafe) {
+				t.Fatalf("应拒绝不安全的压缩包，实际错误: %v", err)
+			}
+			if _, err := os.Lstat(filepath.Join(filepath.Dir(dir), "evil")); err == nil {
+				t.Fatal("解压目录外出现了文件")
+			}
+		})
+	}
+}
+
+func TestExtractZipRejectsUnsafeEntries(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{"上级目录", []testEntry{{name: "../evil", body: "x"}}},
+		{"绝对路径", []testEntry{{name: "/tmp/evil", body: "x"}}},
+		{"符号链接指向上级目录", []testEntry{{name: "l", typ: tar.TypeSymlink, link: "../outside"}}},
+		{"条目位于符号链接下", []testEntry{
+			{name: "l", typ: tar.TypeSymlink, link: "."},
+			{name: "l/evil", body: "x"},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := extractTest(t, ARCHIVE_ZIP, c.entries, 1024); !errors.Is(err, errArchiveUnsafe) {
+				t.Fatalf("应拒绝不安全的压缩包，实际错误: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractValidArchive(t *testing.T) {
+	for _, format := range []string{ARCHIVE_TAR_GZ, ARCHIVE_ZIP} {
+		t.Run(format, func(t *testing.T) {
+			dir, err := extractTest(t, format, []testEntry{
+				{name: "./app/", typ: tar.TypeDir},
+				{name: "app/bin/allinone", typ: tar.TypeReg, body: "binary", mode: 04755},
+				{name: "app/web/index.html", typ: tar.TypeReg, body: "<html>"},
+				{name: "app/current", typ: tar.TypeSymlink, link: "bin/allinone"},
+			}, 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "app", "current"))
+			if err != nil || string(data) != "binary" {
+				t.Fatalf("读取符号链接指向的文件: %q, %v", data, err)
+			}
+			fi, err := os.Stat(filepath.Join(dir, "app", "bin", "allinone"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode()&fs.ModeSetuid != 0 {
+				t.Fatal("应去掉 setuid 位")
+			}
+		})
+	}
+}
+
+func TestArchiveFormat(t *testing.T) {
+	cases := []struct {
+		artifact Artifact
+		want     string
+	}{
+		{Artifact{URL: "https://example.com/a.tar.gz"}, ARCHIVE_TAR_GZ},
+		{Artifact{URL: "https://example.com/a.tgz?token=1"}, ARCHIVE_TAR_GZ},
+		{Artifact{URL: "https://example.com/a.tar.xz"}, ARCHIVE_TAR_XZ},
+		{Artifact{URL: "https://example.com/a.ZIP"}, ARCHIVE_ZIP},
+		{Artifact{URL: "https://example.com/allinone"}, ARCHIVE_NONE},
+		{Artifact{URL: "https://example.com/a.zip", Format: ARCHIVE_NONE}, ARCHIVE_NONE},
+	}
+	for _, c := range cases {
+		got, err := archiveFormat(c.artifact, "")
+		if err != nil || got != c.want {
+			t.Errorf("archiveFormat(%+v) = %q, %v，应为 %q", c.artifact, got, err, c.want)
+		}
+	}
+	if _, err := archiveFormat(Artifact{Format: "rar"}, ""); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
@@ -0,0 +1,235 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Artifact 某个平台的制品。为兼容旧服务器，JSON 中也可以直接写下载链接字符串
+type Artifact struct {
+	URL string `json:"url"`
+	// Mirrors 内容相同的其他下载地址
+	Mirrors []string `json:"mirrors,omitempty"`
+	// SHA256 制品内容的 SHA-256（hex）
+	SHA256 string `json:"sha256,omitempty"`
+	// Size 制品大小（字节），为 0 时不校验
+	Size int64 `json:"size,omitempty"`
+	// Signature minisign 格式的签名文件内容（.minisig）
+	Signature string `json:"signature,omitempty"`
+	// Format 制品格式：tar.gz、tar.xz、zip 或 binary，为空时根据地址扩展名和文件头识别
+	Format string `json:"format,omitempty"`
+	// Executable 压缩包中可执行文件的相对路径，为空时使用与 local_file 同名的文件
+	Executable string `json:"executable,omitempty"`
+	// Patches 从指定旧版本到该制品的差分补丁，本地程序文件匹配时优先下载补丁
+	Patches []Patch `json:"patches,omitempty"`
+
+	// verifiedLater 内容由调用方另行校验（如差分补丁），配置了制品公钥时也不要求签名
+	verifiedLater bool
+}
+
+// UnmarshalJSON 同时支持下载链接字符串和对象两种写法
+func (a *Artifact) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*a = Artifact{URL: url}
+		return nil
+	}
+	type plain Artifact
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// ErrArtifactMismatch 下载的内容与版本信息中的摘要、大小或签名不一致
+var ErrArtifactMismatch = errors.New("制品校验失败")
+
+// minisign 签名算法标识：Ed 直接签名文件内容，ED 签名文件内容的 BLAKE2b-512 摘要
+const (
+	minisignAlgLegacy   = "Ed"
+	minisignAlgPrehash  = "ED"
+	minisignKeyIDSize   = 8
+	minisignTrustedHead = "trusted comment: "
+)
+
+// minisignPublicKey minisign 公钥
+type minisignPublicKey struct {
+	keyID [minisignKeyIDSize]byte
+	key   ed25519.PublicKey
+}
+
+// minisignSignature 解析后的 minisign 签名
+type minisignSignature struct {
+	algorithm       string
+	keyID           [minisignKeyIDSize]byte
+	signature       []byte
+	trustedComment  string
+	globalSignature []byte
+}
+
+// parseMinisignPublicKeys 解析 minisign 公钥，支持公钥文件内容或其中的 base64 行
+func parseMinisignPublicKeys(encoded []string) ([]minisignPublicKey, error) {
+	keys := make([]minisignPublicKey, 0, len(encoded))
+	for _, s := range encoded {
+		lines := strings.Split(strings.TrimSpace(s), "\n")
+		line := strings.TrimSpace(lines[len(lines)-1])
+		data, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("公钥 %q 不是有效的 base64 编码: %v", line, err)
+		}
+		if len(data) != 2+minisignKeyIDSize+ed25519.PublicKeySize || string(data[:2]) != minisignAlgLegacy {
+			return nil, fmt.Errorf("公钥 %q 不是有效的 minisign 公钥", line)
+		}
+		var pk minisignPublicKey
+		copy(pk.keyID[:], data[2:2+minisignKeyIDSize])
+		pk.key = ed25519.PublicKey(data[2+minisignKeyIDSize:])
+		keys = append(keys, pk)
+	}
+	return keys, nil
+}
+
+// parseMinisignSignature 解析 .minisig 文件内容
+func parseMinisignSignature(text string) (*minisignSignature, error) {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n")), "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("签名格式错误，应包含 4 行")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(data) != 2+minisignKeyIDSize+ed25519.SignatureSize {
+		return nil, fmt.Errorf("签名格式错误")
+	}
+	if !strings.HasPrefix(lines[2], minisignTrustedHead) {
+		return nil, fmt.Errorf("签名缺少 trusted comment")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("签名的全局签名格式错误")
+	}
+
+	sig := &minisignSignature{
+		algorithm:       string(data[:2]),
+		signature:       data[2+minisignKeyIDSize:],
+		trustedComment:  strings.TrimPrefix(lines[2], minisignTrustedHead),
+		globalSignature: global,
+	}
+	copy(sig.keyID[:], data[2:2+minisignKeyIDSize])
+	if sig.algorithm != minisignAlgLegacy && sig.algorithm != minisignAlgPrehash {
+		return nil, fmt.Errorf("不支持的签名算法 %q", sig.algorithm)
+	}
+	return sig, nil
+}
+
+// artifactVerifier 在写入临时文件的同时计算摘要，写入完成后校验大小、摘要和签名
+type artifactVerifier struct {
+	artifact Artifact
+	keys     []minisignPublicKey
+	sig      *minisignSignature
+	sha      hash.Hash
+	blake    hash.Hash
+	written  int64
+}
+
+// newArtifactVerifier 创建校验器。制品必须提供 SHA-256 摘要，配置了 artifact_public_keys 时还必须带有签名
+func newArtifactVerifier(a Artifact, keys []minisignPublicKey) (*artifactVerifier, error) {
+	v := &artifactVerifier{artifact: a, keys: keys, sha: sha256.New()}
+	if a.Signature != "" {
+		sig, err := parseMinisignSignature(a.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrArtifactMismatch, err)
+		}
+		v.sig = sig
+		if sig.algorithm == minisignAlgPrehash {
+			v.blake, _ = blake2b.New512(nil)
+		}
+	} else if len(keys) > 0 {
+		return nil, fmt.Errorf("%w: 制品没有签名", ErrArtifactMismatch)
+	}
+	if a.SHA256 == "" {
+		return nil, fmt.Errorf("%w: 制品没有提供 SHA-256 摘要", ErrArtifactMismatch)
+	}
+	return v, nil
+}
+
+// wrap 返回带大小限制的读取器，避免下载超出声明大小的内容
+func (v *artifactVerifier) wrap(r io.Reader) io.Reader {
+	if v.artifact.Size > 0 {
+		return io.LimitReader(r, v.artifact.Size+1)
+	}
+	return r
+}
+
+func (v *artifactVerifier) Write(p []byte) (int, error) {
+	v.written += int64(len(p))
+	v.sha.Write(p)
+	if v.blake != nil {
+		v.blake.Write(p)
+	}
+	return len(p), nil
+}
+
+// verify 校验已写入 path 的内容
+func (v *artifactVerifier) verify(path string) error {
+	if v.artifact.Size > 0 && v.written != v.artifact.Size {
+		return fmt.Errorf("%w: 大小应为 %d 字节，实际为 %d 字节", ErrArtifactMismatch, v.artifact.Size, v.written)
+	}
+
+	if v.artifact.SHA256 != "" {
+		sum := hex.EncodeToString(v.sha.Sum(nil))
+		if !strings.EqualFold(sum, v.artifact.SHA256) {
+			return fmt.Errorf("%w: SHA-256 应为 %s，实际为 %s", ErrArtifactMismatch, v.artifact.SHA256, sum)
+		}
+	}
+
+	if v.sig == nil {
+		return nil
+	}
+	var key *minisignPublicKey
+	for i := range v.keys {
+		if v.keys[i].keyID == v.sig.keyID {
+			key = &v.keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("%w: 签名公钥 %X 不在 artifact_public_keys 中", ErrArtifactMismatch, reverseKeyID(v.sig.keyID))
+	}
+
+	var message []byte
+	if v.blake != nil {
+		message = v.blake.Sum(nil)
+	} else {
+		// 旧格式签名覆盖完整文件内容，只能在写入完成后重新读取
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("读取临时文件失败: %v", err)
+		}
+		message = data
+	}
+	if !ed25519.Verify(key.key, message, v.sig.signature) {
+		return fmt.Errorf("%w: 签名无效", ErrArtifactMismatch)
+	}
+	global := append(append([]byte{}, v.sig.signature...), v.sig.trustedComment...)
+	if !ed25519.Verify(key.key, global, v.sig.globalSignature) {
+		return fmt.Errorf("%w: trusted comment 签名无效", ErrArtifactMismatch)
+	}
+	return nil
+}
+
+// reverseKeyID minisign 以小端序存储密钥 ID，显示时与 minisign 工具保持一致
+func reverseKeyID(id [minisignKeyIDSize]byte) []byte {
+	out := bytes.Clone(id[:])
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
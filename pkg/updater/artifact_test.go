@@ -0,0 +1,123 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testMinisignKey 测试用的 minisign 密钥
+type testMinisignKey struct {
+	id   [minisignKeyIDSize]byte
+	priv ed25519.PrivateKey
+}
+
+func newTestMinisignKey(t *testing.T) *testMinisignKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &testMinisignKey{priv: priv}
+	if _, err := rand.Read(k.id[:]); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// publicKey 返回 minisign -G 生成的公钥文件中的 base64 行
+func (k *testMinisignKey) publicKey() string {
+	data := append([]byte(minisignAlgLegacy), k.id[:]...)
+	return base64.StdEncoding.EncodeToString(append(data, k.priv.Public().(ed25519.PublicKey)...))
+}
+
+// sign 与 minisign -S 一样生成 .minisig 文件内容，prehash 为 false 时使用旧格式直接签名文件内容
+func (k *testMinisignKey) sign(data []byte, trusted string, prehash bool) string {
+	alg, message := minisignAlgLegacy, data
+	if prehash {
+		sum := blake2b.Sum512(data)
+		alg, message = minisignAlgPrehash, sum[:]
+	}
+	sig := ed25519.Sign(k.priv, message)
+	line := append(append([]byte(alg), k.id[:]...), sig...)
+	global := ed25519.Sign(k.priv, append(append([]byte{}, sig...), trusted...))
+	return fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\n%s%s\n%s\n",
+		base64.StdEncoding.EncodeToString(line), minisignTrustedHead, trusted, base64.StdEncoding.EncodeToString(global))
+}
+
+// verifyArtifact 将 data 写入临时文件并按 artifact 和 keys 校验
+func verifyArtifact(t *testing.T, data []byte, artifact Artifact, keys []string) error {
+	t.Helper()
+	parsed, err := parseMinisignPublicKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := newArtifactVerifier(artifact, parsed)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(t.TempDir(), "artifact")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	v.Write(data)
+	return v.verify(file)
+}
+
+func TestArtifactVerifier(t *testing.T) {
+	data := []byte("allinone 1.2.0")
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	key := newTestMinisignKey(t)
+	other := newTestMinisignKey(t)
+
+	// 使用其他私钥签名但声称是 key 的签名
+	forged := strings.Split(other.sign(data, "forged", true), "\n")
+	raw, _ := base64.StdEncoding.DecodeString(forged[1])
+	copy(raw[2:], key.id[:])
+	forged[1] = base64.StdEncoding.EncodeToString(raw)
+
+	// 修改 trusted comment 而不重新生成全局签名
+	tampered := strings.Replace(key.sign(data, "allinone 1.2.0", true), "allinone 1.2.0", "allinone 9.9.9", 1)
+
+	cases := []struct {
+		name     string
+		artifact Artifact
+		keys     []string
+		ok       bool
+	}{
+		{"只校验摘要", Artifact{SHA256: digest, Size: int64(len(data))}, nil, true},
+		{"签名有效", Artifact{SHA256: digest, Signature: key.sign(data, "allinone 1.2.0", true)}, []string{key.publicKey()}, true},
+		{"旧格式签名有效", Artifact{SHA256: digest, Signature: key.sign(data, "allinone 1.2.0", false)}, []string{other.publicKey(), key.publicKey()}, true},
+		{"没有摘要", Artifact{}, nil, false},
+		{"摘要不一致", Artifact{SHA256: strings.Repeat("0", 64)}, nil, false},
+		{"大小不一致", Artifact{SHA256: digest, Size: 1}, nil, false},
+		{"配置了公钥但没有签名", Artifact{SHA256: digest}, []string{key.publicKey()}, false},
+		{"签名内容不一致", Artifact{SHA256: digest, Signature: key.sign([]byte("other"), "allinone 1.2.0", true)}, []string{key.publicKey()}, false},
+		{"公钥 ID 不匹配", Artifact{SHA256: digest, Signature: other.sign(data, "allinone 1.2.0", true)}, []string{key.publicKey()}, false},
+		{"冒用公钥 ID", Artifact{SHA256: digest, Signature: strings.Join(forged, "\n")}, []string{key.publicKey()}, false},
+		{"trusted comment 被修改", Artifact{SHA256: digest, Signature: tampered}, []string{key.publicKey()}, false},
+		{"签名格式错误", Artifact{SHA256: digest, Signature: "untrusted comment\nAAAA\n"}, []string{key.publicKey()}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := verifyArtifact(t, data, c.artifact, c.keys)
+			if c.ok && err != nil {
+				t.Fatalf("应校验通过: %v", err)
+			}
+			if !c.ok && !errors.Is(err, ErrArtifactMismatch) {
+				t.Fatalf("应返回 ErrArtifactMismatch，实际错误: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// BUNDLE_FILE_MODE 附加文件默认的权限
+const BUNDLE_FILE_MODE = 0644
+
+// BundleFile 与可执行文件一起发布的附加文件，如网页资源和默认配置
+type BundleFile struct {
+	// Path 安装路径。普通文件相对于版本目录，配置文件相对于 config_files_dir
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	// Mirrors 内容相同的其他下载地址
+	Mirrors []string `json:"mirrors,omitempty"`
+	// SHA256 文件内容的 SHA-256（hex）
+	SHA256 string `json:"sha256,omitempty"`
+	// Size 文件大小（字节），为 0 时不校验
+	Size int64 `json:"size,omitempty"`
+	// Signature minisign 格式的签名文件内容（.minisig）
+	Signature string `json:"signature,omitempty"`
+	// Mode 八进制的文件权限，如 "0755"，为空时为 0644
+	Mode string `json:"mode,omitempty"`
+	// Config 是否为配置文件。配置文件安装在版本目录之外，用户修改过时不会被覆盖，
+	// 新的默认配置写入同目录下的 <path>.new
+	Config bool `json:"config,omitempty"`
+}
+
+// artifact 返回下载和校验该文件使用的制品
+func (f BundleFile) artifact() Artifact {
+	return Artifact{URL: f.URL, Mirrors: f.Mirrors, SHA256: f.SHA256, Size: f.Size, Signature: f.Signature}
+}
+
+// mode 解析文件权限，去掉 setuid 等特殊位
+func (f BundleFile) mode() (fs.FileMode, error) {
+	if f.Mode == "" {
+		return BUNDLE_FILE_MODE, nil
+	}
+	m, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("文件 %s 的权限 %q 无效", f.Path, f.Mode)
+	}
+	return fs.FileMode(m), nil
+}
+
+// stagedConfig 已下载并校验、等待安装的配置文件
+type stagedConfig struct {
+	path   string
+	target string
+	// dest 实际写入的路径：target，或用户修改过时的 target.new
+	dest   string
+	tmp    string
+	digest string
+	// backup 提交前 dest 的硬链接，提交失败时用于恢复
+	backup string
+}
+
+// stagedConfigs 等待安装的配置文件
+type stagedConfigs []stagedConfig
+
+// cleanup 删除没有安装的临时文件
+func (s stagedConfigs) cleanup() {
+	for _, c := range s {
+		os.Remove(c.tmp)
+	}
+}
+
+// stageBundleFiles 下载并校验全部附加文件：普通文件放入正在准备的版本目录，配置文件保留在临时文件中，
+// 在程序文件切换到新版本后再提交
+func (u *Updater) stageBundleFiles(src Source, x *archiveExtractor, files []BundleFile) (stagedConfigs, error) {
+	var configs stagedConfigs
+	for _, f := range files {
+		mode, err := f.mode()
+		if err != nil {
+			return configs, err
+		}
+
+		var target string
+		if f.Config {
+			if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+				return configs, fmt.Errorf("配置文件路径 %q 不在 config_files_dir 内", f.Path)
+			}
+			target = filepath.Join(u.path(u.cfg.ConfigFilesDir), filepath.FromSlash(f.Path))
+			if own, ok := u.ownFile(target); ok {
+				return configs, fmt.Errorf("配置文件 %q 会覆盖更新器自己的文件 %s", f.Path, own)
+			}
+		} else if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+			return configs, fmt.Errorf("文件路径 %q 不在版本目录内", f.Path)
+		} else if target, err = x.safePath(f.Path); err != nil {
+			return configs, fmt.Errorf("文件路径 %q 无效: %v", f.Path, err)
+		}
+
+		u.logf("下载附加文件 %s", f.Path)
+		tmp, err := u.fetchArtifact(src, f.artifact())
+		if err != nil {
+			return configs, fmt.Errorf("下载 %s 失败: %w", f.Path, err)
+		}
+		if err := os.Chmod(tmp, mode); err != nil {
+			os.Remove(tmp)
+			return configs, fmt.Errorf("设置 %s 的权限失败: %v", f.Path, err)
+		}
+
+		if f.Config {
+			digest, err := fileSHA256(tmp)
+			if err != nil {
+				os.Remove(tmp)
+				return configs, err
+			}
+			configs = append(configs, stagedConfig{path: f.Path, target: target, tmp: tmp, digest: digest})
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			os.Remove(tmp)
+			return configs, err
+		}
+		if err := os.Rename(tmp, target); err != nil {
+			os.Remove(tmp)
+			return configs, fmt.Errorf("放置 %s 失败: %v", f.Path, err)
+		}
+	}
+	return configs, nil
+}
+
+// ownFile 判断路径是否为更新器自己的文件或位于其目录之下
+func (u *Updater) ownFile(target string) (string, bool) {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return target, true
+	}
+	for _, own := range u.cfg.ownFiles() {
+		if own[1] == "" {
+			continue
+		}
+		if p, err := filepath.Abs(u.path(own[1])); err == nil && isWithin(p, abs) {
+			return own[1], true
+		}
+	}
+	return "", false
+}
+
+// prepareConfigFiles 决定每个配置文件写入的位置，并把临时文件移到目标所在的目录，
+// 之后提交只需要同一目录内的重命名。文件不存在或与上次安装的默认配置相同（用户没有修改）时替换原文件；
+// 用户修改过时保留原文件，新的默认配置写入 <path>.new
+func (u *Updater) prepareConfigFiles(configs stagedConfigs) error {
+	u.stateMu.Lock()
+	installed := u.state.ConfigFiles
+	u.stateMu.Unlock()
+
+	for i := range configs {
+		c := &configs[i]
+		c.dest = c.target
+		current, err := fileSHA256(c.target)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return fmt.Errorf("读取配置文件 %s 失败: %v", c.path, err)
+		case current != installed[c.path] && current != c.digest:
+			c.dest = c.target + ".new"
+		}
+
+		dir := filepath.Dir(c.dest)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建配置文件目录失败: %v", err)
+		}
+		staged, err := os.CreateTemp(dir, "."+filepath.Base(c.target)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("暂存配置文件 %s 失败: %v", c.path, err)
+		}
+		staged.Close()
+		if err := os.Rename(c.tmp, staged.Name()); err != nil {
+			os.Remove(staged.Name())
+			return fmt.Errorf("暂存配置文件 %s 失败: %v", c.path, err)
+		}
+		c.tmp = staged.Name()
+	}
+	return nil
+}
+
+// commit 将暂存的配置文件重命名到目标位置，任何一个失败时恢复已提交的文件
+func (s stagedConfigs) commit() error {
+	for i := range s {
+		c := &s[i]
+		if _, err := os.Lstat(c.dest); err == nil {
+			c.backup = c.tmp + ".bak"
+			if err := os.Link(c.dest, c.backup); err != nil {
+				c.backup = ""
+				s[:i].rollback()
+				return fmt.Errorf("备份配置文件 %s 失败: %v", c.path, err)
+			}
+		}
+		if err := os.Rename(c.tmp, c.dest); err != nil {
+			if c.backup != "" {
+				os.Remove(c.backup)
+			}
+			s[:i].rollback()
+			return fmt.Errorf("安装配置文件 %s 失败: %v", c.path, err)
+		}
+	}
+	for _, c := range s {
+		if c.backup != "" {
+			os.Remove(c.backup)
+		}
+	}
+	return nil
+}
+
+// rollback 恢复已提交的配置文件
+func (s stagedConfigs) rollback() {
+	for _, c := range s {
+		if c.backup != "" {
+			os.Rename(c.backup, c.dest)
+		} else {
+			os.Remove(c.dest)
+		}
+	}
+}
+
+// recordConfigFiles 记录已安装的默认配置的摘要，用于下次判断用户是否修改过
+func (u *Updater) recordConfigFiles(configs stagedConfigs) {
+	if len(configs) == 0 {
+		return
+	}
+	for _, c := range configs {
+		if c.dest == c.target {
+			u.logf("已安装配置文件 %s", c.path)
+		} else {
+			u.logf("配置文件 %s 已被修改，保留原文件，新的默认配置写入 %s.new", c.path, c.path)
+		}
+	}
+	if err := u.updateState(func(st *State) {
+		if st.ConfigFiles == nil {
+			st.ConfigFiles = map[string]string{}
+		}
+		for _, c := range configs {
+			st.ConfigFiles[c.path] = c.digest
+		}
+	}); err != nil {
+		u.logf("保存配置文件摘要失败: %v", err)
+	}
+}
+
+// fileSHA256 计算文件内容的 SHA-256（hex）
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,197 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bundleTest 提供附加文件下载的更新器和正在准备的版本目录
+type bundleTest struct {
+	u   *Updater
+	src Source
+	srv *httptest.Server
+	x   *archiveExtractor
+}
+
+func newBundleTest(t *testing.T) *bundleTest {
+	b := &bundleTest{}
+	b.srv = httptest.NewServer(http.StripPrefix("/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + r.URL.Path))
+	})))
+	t.Cleanup(b.srv.Close)
+	b.u = newTestUpdater(t, staticTestConfig(b.srv))
+	var err error
+	if b.src, err = b.u.source(); err != nil {
+		t.Fatal(err)
+	}
+	b.x = &archiveExtractor{dir: t.TempDir(), maxSize: b.u.cfg.ArchiveMaxSize, symlinks: map[string]bool{}}
+	return b
+}
+
+// file 返回安装到 path 的附加文件，下载内容为 "content of <name>"
+func (b *bundleTest) file(path, name string, config bool) BundleFile {
+	sum := sha256.Sum256([]byte("content of " + name))
+	return BundleFile{Path: path, URL: b.srv.URL + "/files/" + name, SHA256: hex.EncodeToString(sum[:]), Config: config}
+}
+
+// configPath 返回配置文件的安装路径
+func (b *bundleTest) configPath(path string) string {
+	return filepath.Join(b.u.path(b.u.cfg.ConfigFilesDir), filepath.FromSlash(path))
+}
+
+// install 下载、暂存并提交配置文件，与安装新版本时的步骤相同
+func (b *bundleTest) install(files ...BundleFile) (stagedConfigs, error) {
+	configs, err := b.u.stageBundleFiles(b.src, b.x, files)
+	defer configs.cleanup()
+	if err != nil {
+		return configs, err
+	}
+	if err := b.u.prepareConfigFiles(configs); err != nil {
+		return configs, err
+	}
+	if err := configs.commit(); err != nil {
+		return configs, err
+	}
+	b.u.recordConfigFiles(configs)
+	return configs, nil
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStageBundleFiles(t *testing.T) {
+	b := newBundleTest(t)
+	page := b.file("web/index.html", "index-v1", false)
+	page.Mode = "0600"
+	configs, err := b.u.stageBundleFiles(b.src, b.x, []BundleFile{page, b.file("app.yaml", "app-v1", true)})
+	defer configs.cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(b.x.dir, "web", "index.html")
+	if got := readString(t, target); got != "content of index-v1" {
+		t.Fatalf("普通文件应放入版本目录，实际内容为 %q", got)
+	}
+	if fi, _ := os.Stat(target); fi.Mode().Perm() != 0600 {
+		t.Fatalf("文件权限应为 0600，实际为 %v", fi.Mode().Perm())
+	}
+	if len(configs) != 1 || configs[0].target != b.configPath("app.yaml") {
+		t.Fatalf("配置文件应暂存到提交时，实际为 %+v", configs)
+	}
+	if _, err := os.Stat(b.configPath("app.yaml")); !os.IsNotExist(err) {
+		t.Fatal("提交前不应修改配置文件")
+	}
+
+	bad := b.file("app.yaml", "app-v1", true)
+	bad.SHA256 = strings.Repeat("0", 64)
+	cases := []struct {
+		name string
+		file BundleFile
+		err  error
+	}{
+		{"普通文件路径越界", b.file("../escape", "x", false), nil},
+		{"配置文件路径越界", b.file("../../escape.yaml", "x", true), nil},
+		{"权限无效", BundleFile{Path: "x", Mode: "4755"}, nil},
+		{"摘要不一致", bad, ErrArtifactMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			configs, err := b.u.stageBundleFiles(b.src, b.x, []BundleFile{c.file})
+			configs.cleanup()
+			if err == nil {
+				t.Fatal("应拒绝该附加文件")
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("应返回 %v，实际错误: %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestCommitConfigFiles(t *testing.T) {
+	b := newBundleTest(t)
+	target := b.configPath("app.yaml")
+
+	// 首次安装
+	if _, err := b.install(b.file("app.yaml", "app-v1", true)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, target); got != "content of app-v1" {
+		t.Fatalf("配置文件不存在时应直接安装，实际内容为 %q", got)
+	}
+
+	// 用户没有修改时替换为新的默认配置
+	if _, err := b.install(b.file("app.yaml", "app-v2", true)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, target); got != "content of app-v2" {
+		t.Fatalf("用户没有修改的配置文件应被替换，实际内容为 %q", got)
+	}
+
+	// 用户修改过时保留原文件，新的默认配置写入 .new
+	if err := os.WriteFile(target, []byte("user settings"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.install(b.file("app.yaml", "app-v3", true)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, target); got != "user settings" {
+		t.Fatalf("用户修改过的配置文件不应被覆盖，实际内容为 %q", got)
+	}
+	if got := readString(t, target+".new"); got != "content of app-v3" {
+		t.Fatalf("新的默认配置应写入 .new，实际内容为 %q", got)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(target), ".*.tmp*"))
+	if len(matches) > 0 {
+		t.Fatalf("提交后不应留下临时文件: %v", matches)
+	}
+}
+
+func TestCommitConfigFilesRollback(t *testing.T) {
+	b := newBundleTest(t)
+	first, second := b.configPath("a.yaml"), b.configPath("b.yaml")
+	if _, err := b.install(b.file("a.yaml", "a-v1", true)); err != nil {
+		t.Fatal(err)
+	}
+	// b.yaml 是非空目录，提交时无法替换
+	if err := os.MkdirAll(filepath.Join(second, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.install(b.file("a.yaml", "a-v2", true), b.file("b.yaml", "b-v2", true)); err == nil {
+		t.Fatal("无法替换 b.yaml 时提交应失败")
+	}
+	if got := readString(t, first); got != "content of a-v1" {
+		t.Fatalf("提交失败时应恢复已提交的配置文件，实际内容为 %q", got)
+	}
+	if fi, err := os.Stat(second); err != nil || !fi.IsDir() {
+		t.Fatalf("提交失败时不应修改 b.yaml: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(first), ".*"))
+	if len(matches) > 0 {
+		t.Fatalf("提交失败后不应留下临时文件或备份: %v", matches)
+	}
+
+	// 没有提交成功的版本不记录摘要，下次仍然按用户没有修改处理
+	if _, err := b.install(b.file("a.yaml", "a-v2", true)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, first); got != "content of a-v2" {
+		t.Fatalf("a.yaml 应更新为 a-v2，实际内容为 %q", got)
+	}
+}
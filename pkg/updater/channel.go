@@ -0,0 +1,135 @@
+package updater
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// 发布频道
+const (
+	CHANNEL_STABLE  = "stable"
+	CHANNEL_BETA    = "beta"
+	CHANNEL_NIGHTLY = "nightly"
+)
+
+// IsValidChannel 判断是否为支持的发布频道
+func IsValidChannel(channel string) bool {
+	switch channel {
+	case CHANNEL_STABLE, CHANNEL_BETA, CHANNEL_NIGHTLY:
+		return true
+	}
+	return false
+}
+
+// Channel 返回当前生效的发布频道，通过 SetChannel 切换的频道优先于配置
+func (u *Updater) Channel() string {
+	u.stateMu.Lock()
+	channel := u.state.Channel
+	u.stateMu.Unlock()
+	if channel != "" {
+		return channel
+	}
+	return u.cfg.Channel
+}
+
+// SetChannel 切换发布频道并保存到状态文件，下次检查更新时生效。
+// 切换后的第一次更新允许降级，以便从 beta、nightly 回到 stable 的最新版本
+func (u *Updater) SetChannel(channel string) error {
+	if !IsValidChannel(channel) {
+		return fmt.Errorf("不支持的发布频道: %s，可选 %s、%s、%s", channel, CHANNEL_STABLE, CHANNEL_BETA, CHANNEL_NIGHTLY)
+	}
+	old := u.Channel()
+	if old == channel {
+		return nil
+	}
+	if err := u.updateState(func(st *State) {
+		st.Channel = channel
+		st.ChannelSwitch = true
+	}); err != nil {
+		return err
+	}
+	u.logf("发布频道已切换: %s -> %s", old, channel)
+	return nil
+}
+
+// channelSwitchPending 是否刚切换了频道且尚未安装新频道的版本
+func (u *Updater) channelSwitchPending() bool {
+	u.stateMu.Lock()
+	defer u.stateMu.Unlock()
+	return u.state.ChannelSwitch
+}
+
+// finishChannelSwitch 新频道的版本已安装，取消切换频道时允许的降级
+func (u *Updater) finishChannelSwitch() {
+	if !u.channelSwitchPending() {
+		return
+	}
+	if err := u.updateState(func(st *State) { st.ChannelSwitch = false }); err != nil {
+		u.logf("%v", err)
+	}
+}
+
+// channelURL 在版本接口地址中加入 channel 查询参数，使其包含在请求签名中
+func channelURL(rawURL, channel string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("接口地址无效: %v", err)
+	}
+	q := u.Query()
+	q.Set("channel", channel)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// manifestHeader 返回获取版本信息时附带的平台和频道请求头
+func (u *Updater) manifestHeader() http.Header {
+	h := platformHeader()
+	h.Set("X-Channel", u.Channel())
+	return h
+}
+
+// selectChannel 从按频道划分的版本信息中选出指定频道的版本。
+// 版本信息没有 channels 时视为服务器已按频道返回；channels 中没有该频道时使用顶层版本。
+// 顶层的 min_version、blocked_versions 和 rollout 对所有频道生效，见 mergeChannelPolicy
+func (u *Updater) selectChannel(info *VersionInfo, channel string) (*VersionInfo, error) {
+	if len(info.Channels) == 0 {
+		return info, nil
+	}
+	if ci, ok := info.Channels[channel]; ok {
+		u.logf("使用 %s 频道的版本: %s", channel, ci.Version)
+		u.mergeChannelPolicy(&ci, info)
+		return &ci, nil
+	}
+	if info.Version == "" {
+		return nil, fmt.Errorf("版本信息中没有 %s 频道", channel)
+	}
+	u.logf("版本信息中没有 %s 频道，使用默认版本: %s", channel, info.Version)
+	return info, nil
+}
+
+// mergeChannelPolicy 把顶层的发布策略合并到频道的版本信息中：blocked_versions 取并集，
+// min_version 取两者中较高的一个，频道没有 rollout 时使用顶层的 rollout
+func (u *Updater) mergeChannelPolicy(ci, top *VersionInfo) {
+	if len(top.BlockedVersions) > 0 {
+		blocked := make([]string, 0, len(ci.BlockedVersions)+len(top.BlockedVersions))
+		ci.BlockedVersions = append(append(blocked, ci.BlockedVersions...), top.BlockedVersions...)
+	}
+
+	if top.MinVersion != "" {
+		switch topMin, err := ParseVersion(top.MinVersion); {
+		case err != nil:
+			u.logf("忽略无效的最低版本 %q: %v", top.MinVersion, err)
+		case ci.MinVersion == "":
+			ci.MinVersion = top.MinVersion
+		default:
+			if chMin, err := ParseVersion(ci.MinVersion); err != nil || topMin.Compare(chMin) > 0 {
+				ci.MinVersion = top.MinVersion
+			}
+		}
+	}
+
+	if ci.Rollout == nil {
+		ci.Rollout = top.Rollout
+	}
+}
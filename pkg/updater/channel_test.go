@@ -0,0 +1,59 @@
+package updater
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectChannelMergesTopLevelPolicy(t *testing.T) {
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.Source = SOURCE_STATIC
+		cfg.SourceURL = "https://example.com/manifest.json"
+		cfg.AllowUnsignedManifest = true
+	})
+	topRollout := &Rollout{Percentage: 10}
+	betaRollout := &Rollout{Percentage: 50}
+	info := &VersionInfo{
+		Version:         "1.2.0",
+		MinVersion:      "1.1.0",
+		BlockedVersions: []string{"1.1.5"},
+		Rollout:         topRollout,
+		Channels: map[string]VersionInfo{
+			CHANNEL_BETA:    {Version: "1.3.0-beta.2", MinVersion: "1.0.0", BlockedVersions: []string{"1.3.0-beta.1"}},
+			CHANNEL_NIGHTLY: {Version: "1.4.0-nightly.1", MinVersion: "1.2.0", Rollout: betaRollout},
+		},
+	}
+
+	cases := []struct {
+		channel    string
+		version    string
+		minVersion string
+		blocked    []string
+		rollout    *Rollout
+	}{
+		{CHANNEL_STABLE, "1.2.0", "1.1.0", []string{"1.1.5"}, topRollout},
+		{CHANNEL_BETA, "1.3.0-beta.2", "1.1.0", []string{"1.3.0-beta.1", "1.1.5"}, topRollout},
+		{CHANNEL_NIGHTLY, "1.4.0-nightly.1", "1.2.0", []string{"1.1.5"}, betaRollout},
+	}
+	for _, c := range cases {
+		t.Run(c.channel, func(t *testing.T) {
+			got, err := u.selectChannel(info, c.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != c.version || got.MinVersion != c.minVersion || !reflect.DeepEqual(got.BlockedVersions, c.blocked) || got.Rollout != c.rollout {
+				t.Fatalf("应为 %s min_version=%s blocked=%v rollout=%+v，实际为 %s min_version=%s blocked=%v rollout=%+v",
+					c.version, c.minVersion, c.blocked, c.rollout, got.Version, got.MinVersion, got.BlockedVersions, got.Rollout)
+			}
+		})
+	}
+	if blocked := info.Channels[CHANNEL_BETA].BlockedVersions; len(blocked) != 1 {
+		t.Fatalf("合并不应修改原版本信息，beta 的 blocked_versions 为 %v", blocked)
+	}
+
+	// 合并后顶层禁止的本地版本在 beta 频道中同样会被回滚
+	beta, _ := u.selectChannel(info, CHANNEL_BETA)
+	if ok, err := u.needUpdate("1.1.5", nil, beta); err != nil || !ok {
+		t.Fatalf("本地版本被顶层 blocked_versions 禁止时应更新: %v, %v", ok, err)
+	}
+}
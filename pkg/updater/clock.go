@@ -0,0 +1,136 @@
+package updater
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CLOCK_SKEW_THRESHOLD 本地时间与服务器时间相差超过该值时才修正时间偏移
+const CLOCK_SKEW_THRESHOLD = 30 * time.Second
+
+// now 返回按服务器时间修正后的当前时间
+func (u *Updater) now() time.Time {
+	return time.Now().Add(u.clockOffset())
+}
+
+// trustedNow 返回校验证书、TUF 元数据和公钥有效期使用的当前时间。时间偏移来自未经认证的 Date 头，
+// 这里只采用向前的偏移，把时钟往回调无法让已过期的证书、元数据或密钥重新生效；向后的偏移只用于请求签名的时间戳
+func (u *Updater) trustedNow() time.Time {
+	if offset := u.clockOffset(); offset > 0 {
+		return time.Now().Add(offset)
+	}
+	return time.Now()
+}
+
+// clockOffset 返回当前的时间偏移
+func (u *Updater) clockOffset() time.Duration {
+	u.stateMu.Lock()
+	defer u.stateMu.Unlock()
+	return time.Duration(u.state.ClockOffset)
+}
+
+// observeServerDate 根据响应的 Date 头更新时间偏移，偏移发生变化时返回 true。
+// 本地时间与服务器时间相差不超过 CLOCK_SKEW_THRESHOLD 时偏移归零，NTP 同步后自动恢复使用本地时间
+func (u *Updater) observeServerDate(resp *http.Response) bool {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+
+	offset := date.Sub(time.Now())
+	if offset > -CLOCK_SKEW_THRESHOLD && offset < CLOCK_SKEW_THRESHOLD {
+		offset = 0
+	}
+
+	u.stateMu.Lock()
+	current := time.Duration(u.state.ClockOffset)
+	u.stateMu.Unlock()
+	if diff := offset - current; diff > -CLOCK_SKEW_THRESHOLD && diff < CLOCK_SKEW_THRESHOLD {
+		return false
+	}
+
+	offset = offset.Round(time.Second)
+	if err := u.updateState(func(st *State) { st.ClockOffset = Duration(offset) }); err != nil {
+		u.logf("保存时间偏移失败: %v", err)
+	}
+	u.log.SetClockOffset(offset)
+	u.logf("根据服务器时间修正本地时间偏移: %s", offset)
+	return true
+}
+
+// isCertificateTimeError 判断 TLS 握手是否因证书不在有效期内而失败，
+// 通常是本地时间错误，如没有 RTC 的设备启动时时间为 1970 年
+func isCertificateTimeError(err error) bool {
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &invalid) && invalid.Reason == x509.Expired
+}
+
+// probeServerDate 不校验证书向服务器发送 HEAD 请求，只读取 Date 头修正时间偏移，偏移发生变化时返回 true。
+// 未经认证的时间只允许把时钟向前调整，无法用来让已过期的证书或元数据重新生效
+func (u *Updater) probeServerDate(target *url.URL) bool {
+	client := &http.Client{
+		Timeout: time.Duration(u.cfg.RequestTimeout),
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Head(target.Scheme + "://" + target.Host + "/")
+	if err != nil {
+		u.logf("获取服务器时间失败: %v", err)
+		return false
+	}
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil || !date.After(u.trustedNow()) {
+		return false
+	}
+	u.logf("证书校验因本地时间错误失败，使用服务器 %s 的时间", target.Host)
+	return u.observeServerDate(resp)
+}
+
+// clockSyncTransport 证书因本地时间错误校验失败时，从服务器的 Date 头修正时间偏移后重试一次
+type clockSyncTransport struct {
+	u    *Updater
+	base http.RoundTripper
+}
+
+func (t *clockSyncTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil || req.URL.Scheme != "https" || !isCertificateTimeError(err) {
+		return resp, err
+	}
+	if !t.u.probeServerDate(req.URL) {
+		return resp, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return resp, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return resp, err
+		}
+		retry.Body = body
+	}
+	return t.base.RoundTrip(retry)
+}
+
+// isTimestampRejection 判断响应是否可能是服务器因时间戳偏差拒绝了请求
+func isTimestampRejection(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
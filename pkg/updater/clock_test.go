@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// serverDate 模拟带有指定 Date 头的响应
+func serverDate(date time.Time) *http.Response {
+	return &http.Response{Header: http.Header{"Date": {date.UTC().Format(http.TimeFormat)}}}
+}
+
+func TestPastServerDateDoesNotReviveExpiredMetadata(t *testing.T) {
+	repo := newTestTUFRepo(t)
+	repo.publish(1, "1.2.0", time.Now().Add(-time.Hour))
+	u := newTUFTestUpdater(t, repo, time.Now().Add(365*24*time.Hour))
+
+	// 未经认证的响应把时间往回调两小时
+	if !u.observeServerDate(serverDate(time.Now().Add(-2 * time.Hour))) {
+		t.Fatal("应记录时间偏移")
+	}
+	if u.now().After(time.Now().Add(-time.Hour)) {
+		t.Fatalf("请求签名使用的时间应采用向后的偏移，实际为 %s", u.now())
+	}
+
+	if _, err := u.Check(); !errors.Is(err, ErrTUFExpired) {
+		t.Fatalf("向后的时间偏移不应让过期的元数据通过校验，实际错误: %v", err)
+	}
+	tr, err := u.newTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.TLSClientConfig.Time().Before(time.Now().Add(-time.Minute)) {
+		t.Fatal("证书有效期不应按向后的偏移校验")
+	}
+}
+
+func TestFutureServerDateAdvancesTrustedTime(t *testing.T) {
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.ApiUrl = "https://example.com/api/version"
+		cfg.SecretKey = "0123456789abcdef"
+		cfg.AllowUnsignedManifest = true
+	})
+	u.observeServerDate(serverDate(time.Now().Add(2 * time.Hour)))
+	if got := u.trustedNow(); got.Before(time.Now().Add(time.Hour)) {
+		t.Fatalf("向前的时间偏移应用于证书和元数据的有效期，实际为 %s", got)
+	}
+}
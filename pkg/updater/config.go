@@ -0,0 +1,395 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Duration 支持 "12h"、"90s" 这类写法的时间间隔
+type Duration time.Duration
+
+// UnmarshalText 解析时间间隔字符串
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText 输出时间间隔字符串
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config 更新器配置
+type Config struct {
+	ApiUrl    string `json:"api_url" yaml:"api_url" toml:"api_url"`
+	SecretKey string `json:"secret_key" yaml:"secret_key" toml:"secret_key"`
+	// SecretKeyFile 从文件读取密钥，文件权限必须为 0600 或更严格
+	SecretKeyFile string `json:"secret_key_file" yaml:"secret_key_file" toml:"secret_key_file"`
+	// SecretKeyEnv 从指定名称的环境变量读取密钥
+	SecretKeyEnv string `json:"secret_key_env" yaml:"secret_key_env" toml:"secret_key_env"`
+	// SecretKeyEncoding 密钥的编码方式：raw（默认）、hex 或 base64
+	SecretKeyEncoding string   `json:"secret_key_encoding" yaml:"secret_key_encoding" toml:"secret_key_encoding"`
+	CheckInterval     Duration `json:"check_interval" yaml:"check_interval" toml:"check_interval"`
+	LocalFile         string   `json:"local_file" yaml:"local_file" toml:"local_file"`
+	VersionFile       string   `json:"version_file" yaml:"version_file" toml:"version_file"`
+	LogDir            string   `json:"log_dir" yaml:"log_dir" toml:"log_dir"`
+	ServicePort       int      `json:"service_port" yaml:"service_port" toml:"service_port"`
+	ProxyPrefix       string   `json:"proxy_prefix" yaml:"proxy_prefix" toml:"proxy_prefix"`
+	UserAgent         string   `json:"user_agent" yaml:"user_agent" toml:"user_agent"`
+	ProcessName       string   `json:"process_name" yaml:"process_name" toml:"process_name"`
+	ServiceCheckWait  Duration `json:"service_check_wait" yaml:"service_check_wait" toml:"service_check_wait"`
+	PortReleaseWait   Duration `json:"port_release_wait" yaml:"port_release_wait" toml:"port_release_wait"`
+	RequestTimeout    Duration `json:"request_timeout" yaml:"request_timeout" toml:"request_timeout"`
+	DownloadTimeout   Duration `json:"download_timeout" yaml:"download_timeout" toml:"download_timeout"`
+	// SecretKeys 带密钥 ID 和有效期的共享密钥，设置后 secret_key 可以为空
+	SecretKeys []SecretKeyEntry `json:"secret_keys,omitempty" yaml:"secret_keys,omitempty" toml:"secret_keys,omitempty"`
+	// SignVersion 请求签名版本：2 为 HMAC-SHA256（默认），1 为兼容旧服务器的 MD5 签名
+	SignVersion int `json:"sign_version" yaml:"sign_version" toml:"sign_version"`
+	// AllowCBC 允许解密旧服务器返回的 AES-CBC 格式版本信息，该格式没有完整性保护
+	AllowCBC bool `json:"allow_cbc" yaml:"allow_cbc" toml:"allow_cbc"`
+	// ManifestPublicKeys 固定的 Ed25519 公钥（base64），设置后版本信息必须带有其中任一公钥的有效签名
+	ManifestPublicKeys []string `json:"manifest_public_keys" yaml:"manifest_public_keys" toml:"manifest_public_keys"`
+	// ManifestKeys 带密钥 ID 和有效期的版本信息公钥，与 manifest_public_keys 合并使用
+	ManifestKeys []PublicKeyEntry `json:"manifest_keys,omitempty" yaml:"manifest_keys,omitempty" toml:"manifest_keys,omitempty"`
+	// AllowUnsignedManifest 没有设置版本信息公钥且不使用 TUF 元数据时必须显式开启，接受未签名的版本信息
+	AllowUnsignedManifest bool `json:"allow_unsigned_manifest" yaml:"allow_unsigned_manifest" toml:"allow_unsigned_manifest"`
+	// KeyStoreFile 保存服务器下发的轮换密钥的文件
+	KeyStoreFile string `json:"key_store_file" yaml:"key_store_file" toml:"key_store_file"`
+	// TUFMetadataUrl TUF 元数据的地址前缀，只能用于 api 更新源，设置后通过 TUF 元数据获取版本信息，不再请求 api_url
+	TUFMetadataUrl string `json:"tuf_metadata_url" yaml:"tuf_metadata_url" toml:"tuf_metadata_url"`
+	// TUFRootFile 随设备分发的初始 root.json
+	TUFRootFile string `json:"tuf_root_file" yaml:"tuf_root_file" toml:"tuf_root_file"`
+	// TUFMetadataDir 保存已信任的 TUF 元数据的目录
+	TUFMetadataDir string `json:"tuf_metadata_dir" yaml:"tuf_metadata_dir" toml:"tuf_metadata_dir"`
+	// ArtifactPublicKeys minisign 公钥，设置后下载的制品必须带有其中任一公钥的有效签名
+	ArtifactPublicKeys []string `json:"artifact_public_keys" yaml:"artifact_public_keys" toml:"artifact_public_keys"`
+	// AllowUnsignedArtifacts 没有设置 artifact_public_keys 时必须显式开启，制品只校验 SHA-256 摘要
+	AllowUnsignedArtifacts bool `json:"allow_unsigned_artifacts" yaml:"allow_unsigned_artifacts" toml:"allow_unsigned_artifacts"`
+	// TLSCAFile PEM 格式的 CA 证书，设置后替代系统信任的根证书
+	TLSCAFile string `json:"tls_ca_file" yaml:"tls_ca_file" toml:"tls_ca_file"`
+	// TLSCertFile 和 TLSKeyFile 双向 TLS 使用的客户端证书和私钥
+	TLSCertFile string `json:"tls_cert_file" yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file" yaml:"tls_key_file" toml:"tls_key_file"`
+	// TLSPins 按主机名固定的服务器公钥 SPKI 摘要（base64 编码的 SHA-256）
+	TLSPins map[string][]string `json:"tls_pins,omitempty" yaml:"tls_pins,omitempty" toml:"tls_pins,omitempty"`
+	// Source 更新源：api（默认）、static、dir 或 github
+	Source string `json:"source" yaml:"source" toml:"source"`
+	// SourceURL static 更新源的版本信息地址，或 github 更新源的发布接口地址
+	SourceURL string `json:"source_url" yaml:"source_url" toml:"source_url"`
+	// SourceDir dir 更新源的目录，其中包含 manifest.json 和制品
+	SourceDir string `json:"source_dir" yaml:"source_dir" toml:"source_dir"`
+	// GitHubRepo github 更新源的仓库，格式为 owner/name，设置后不使用 source_url
+	GitHubRepo string `json:"github_repo" yaml:"github_repo" toml:"github_repo"`
+	// GitHubTag 使用指定标签的发布，为空时使用最新的发布
+	GitHubTag string `json:"github_tag" yaml:"github_tag" toml:"github_tag"`
+	// GitHubPrerelease 不按发布频道筛选，允许使用所有先行版本（prerelease）的发布
+	GitHubPrerelease bool `json:"github_prerelease" yaml:"github_prerelease" toml:"github_prerelease"`
+	// GitHubAssetPattern 附件名称模式，如 download_allinone_{os}_{arch}_{version}
+	GitHubAssetPattern string `json:"github_asset_pattern" yaml:"github_asset_pattern" toml:"github_asset_pattern"`
+	// GitHubToken 访问私有仓库使用的令牌
+	GitHubToken string `json:"github_token" yaml:"github_token" toml:"github_token"`
+	// GitHubAPIUrl GitHub 接口地址，用于 GitHub Enterprise 或本地替身服务
+	GitHubAPIUrl string `json:"github_api_url" yaml:"github_api_url" toml:"github_api_url"`
+	// ReleasesDir 解压压缩包制品的目录，每个版本一个子目录
+	ReleasesDir string `json:"releases_dir" yaml:"releases_dir" toml:"releases_dir"`
+	// ArchiveMaxSize 压缩包解压后的最大字节数
+	ArchiveMaxSize int64 `json:"archive_max_size" yaml:"archive_max_size" toml:"archive_max_size"`
+	// ConfigFilesDir 发布中配置文件的安装目录，不能包含更新器自己的文件
+	ConfigFilesDir string `json:"config_files_dir" yaml:"config_files_dir" toml:"config_files_dir"`
+	// Channel 发布频道：stable、beta 或 nightly
+	Channel string `json:"channel" yaml:"channel" toml:"channel"`
+	// ProxyPrefixes 其他下载代理前缀，与 proxy_prefix 和直连一起按线路得分排序后尝试
+	ProxyPrefixes []string `json:"proxy_prefixes" yaml:"proxy_prefixes" toml:"proxy_prefixes"`
+	// AllowDowngrade 允许安装低于本地版本的远程版本
+	AllowDowngrade bool `json:"allow_downgrade" yaml:"allow_downgrade" toml:"allow_downgrade"`
+	// StateFile 保存时间偏移等运行状态的文件
+	StateFile string `json:"state_file" yaml:"state_file" toml:"state_file"`
+	// ConfigWatchInterval 轮询配置文件修改时间的间隔，为 0 时只在收到 SIGHUP 时重新加载
+	ConfigWatchInterval Duration `json:"config_watch_interval" yaml:"config_watch_interval" toml:"config_watch_interval"`
+}
+
+// ConfigError 配置校验错误，Field 为出错的配置项名称
+type ConfigError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("配置项 %s %s", e.Field, e.Msg)
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{
+		CheckInterval:    Duration(CHECK_INTERVAL),
+		LocalFile:        LOCAL_FILE,
+		VersionFile:      VERSION_FILE,
+		LogDir:           LOG_DIR,
+		ServicePort:      SERVICE_PORT,
+		ProxyPrefix:      PROXY_PREFIX,
+		UserAgent:        USER_AGENT,
+		ProcessName:      PROCESS_NAME,
+		ServiceCheckWait: Duration(SERVICE_CHECK_WAIT),
+		PortReleaseWait:  Duration(PORT_RELEASE_WAIT),
+		RequestTimeout:   Duration(REQUEST_TIMEOUT),
+		DownloadTimeout:  Duration(DOWNLOAD_TIMEOUT),
+		SignVersion:      SIGN_VERSION_HMAC,
+		KeyStoreFile:     KEY_STORE_FILE,
+		TUFMetadataDir:   TUF_METADATA_DIR,
+		StateFile:        STATE_FILE,
+		Channel:          CHANNEL_STABLE,
+		Source:           SOURCE_API,
+		GitHubAPIUrl:     GITHUB_API_URL,
+		ReleasesDir:      RELEASES_DIR,
+		ArchiveMaxSize:   ARCHIVE_MAX_SIZE,
+		ConfigFilesDir:   CONFIG_FILES_DIR,
+	}
+}
+
+// Validate 校验配置，返回的错误中包含所有出错的配置项
+func (c Config) Validate() error {
+	var errs []error
+	add := func(field, format string, v ...interface{}) {
+		errs = append(errs, &ConfigError{Field: field, Msg: fmt.Sprintf(format, v...)})
+	}
+
+	switch c.Source {
+	case "", SOURCE_API:
+		// 设置了 tuf_metadata_url 时版本信息通过 TUF 元数据获取，不使用 api_url
+		if c.ApiUrl == "" {
+			if c.TUFMetadataUrl == "" {
+				add("api_url", "不能为空")
+			}
+		} else if u, err := url.Parse(c.ApiUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("api_url", "不是有效的 http(s) 地址: %q", c.ApiUrl)
+		}
+	case SOURCE_STATIC:
+		if c.SourceURL == "" {
+			add("source_url", "使用 %s 更新源时不能为空", c.Source)
+		} else if u, err := url.Parse(c.SourceURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("source_url", "不是有效的 http(s) 地址: %q", c.SourceURL)
+		}
+	case SOURCE_GITHUB:
+		if c.GitHubRepo == "" {
+			if c.SourceURL == "" {
+				add("github_repo", "使用 %s 更新源且没有设置 source_url 时不能为空", c.Source)
+			} else if u, err := url.Parse(c.SourceURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("source_url", "不是有效的 http(s) 地址: %q", c.SourceURL)
+			}
+		} else if parts := strings.Split(c.GitHubRepo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			add("github_repo", "格式必须为 owner/name，当前为 %q", c.GitHubRepo)
+		}
+		if u, err := url.Parse(c.GitHubAPIUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("github_api_url", "不是有效的 http(s) 地址: %q", c.GitHubAPIUrl)
+		}
+		if c.GitHubAssetPattern != "" {
+			if _, err := compileAssetPattern(c.GitHubAssetPattern, SemVer{}); err != nil {
+				add("github_asset_pattern", "%v", err)
+			}
+		}
+	case SOURCE_DIR:
+		if c.SourceDir == "" {
+			add("source_dir", "使用 %s 更新源时不能为空", c.Source)
+		}
+	default:
+		add("source", "必须是 %s、%s、%s 或 %s，当前为 %q", SOURCE_API, SOURCE_STATIC, SOURCE_DIR, SOURCE_GITHUB, c.Source)
+	}
+	if _, err := c.secretKeyRing(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.CheckInterval < Duration(time.Minute) {
+		add("check_interval", "不能小于 1m，当前为 %s", time.Duration(c.CheckInterval))
+	}
+	if c.LocalFile == "" {
+		add("local_file", "不能为空")
+	}
+	if c.VersionFile == "" {
+		add("version_file", "不能为空")
+	}
+	if c.LogDir == "" {
+		add("log_dir", "不能为空")
+	}
+	if c.ServicePort <= 0 || c.ServicePort > 65535 {
+		add("service_port", "必须在 1-65535 之间，当前为 %d", c.ServicePort)
+	}
+	if c.ProxyPrefix != "" {
+		if u, err := url.Parse(c.ProxyPrefix); err != nil || u.Scheme == "" || u.Host == "" {
+			add("proxy_prefix", "不是有效的地址前缀: %q", c.ProxyPrefix)
+		}
+	}
+	for _, p := range c.ProxyPrefixes {
+		if u, err := url.Parse(p); err != nil || u.Scheme == "" || u.Host == "" {
+			add("proxy_prefixes", "不是有效的地址前缀: %q", p)
+		}
+	}
+	if c.UserAgent == "" {
+		add("user_agent", "不能为空")
+	}
+	if c.ProcessName == "" {
+		add("process_name", "不能为空")
+	}
+	if c.ServiceCheckWait < 0 {
+		add("service_check_wait", "不能为负数")
+	}
+	if c.PortReleaseWait < 0 {
+		add("port_release_wait", "不能为负数")
+	}
+	if c.RequestTimeout <= 0 {
+		add("request_timeout", "必须大于 0")
+	}
+	if c.DownloadTimeout <= 0 {
+		add("download_timeout", "必须大于 0")
+	}
+	if c.SignVersion != SIGN_VERSION_MD5 && c.SignVersion != SIGN_VERSION_HMAC {
+		add("sign_version", "只能是 1 或 2，当前为 %d", c.SignVersion)
+	}
+	if keys, err := c.manifestKeyRing(); err != nil {
+		errs = append(errs, err)
+	} else if len(keys) > 0 && c.Source == SOURCE_GITHUB {
+		add("manifest_public_keys", "%s 更新源的版本信息由 GitHub 发布生成，无法带签名，不能同时设置版本信息公钥", c.Source)
+	} else if c.Source == SOURCE_GITHUB && !c.AllowUnsignedManifest {
+		add("allow_unsigned_manifest", "%s 更新源的版本信息由 GitHub 发布生成，无法带签名，必须设置为 true", c.Source)
+	} else if len(keys) == 0 && c.TUFMetadataUrl == "" && !c.AllowUnsignedManifest {
+		add("manifest_public_keys", "不能为空，确实接受未签名的版本信息时需要设置 allow_unsigned_manifest")
+	}
+	if c.KeyStoreFile == "" {
+		add("key_store_file", "不能为空")
+	}
+	if c.TUFMetadataUrl != "" {
+		if c.Source != "" && c.Source != SOURCE_API {
+			add("tuf_metadata_url", "只能用于 %s 更新源，%s 更新源不会校验 TUF 元数据", SOURCE_API, c.Source)
+		}
+		if u, err := url.Parse(c.TUFMetadataUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tuf_metadata_url", "不是有效的 http(s) 地址: %q", c.TUFMetadataUrl)
+		}
+		if c.TUFRootFile == "" {
+			add("tuf_root_file", "设置了 tuf_metadata_url 时不能为空")
+		}
+		if c.TUFMetadataDir == "" {
+			add("tuf_metadata_dir", "不能为空")
+		}
+	}
+	if _, err := parseMinisignPublicKeys(c.ArtifactPublicKeys); err != nil {
+		add("artifact_public_keys", "%v", err)
+	} else if len(c.ArtifactPublicKeys) == 0 && !c.AllowUnsignedArtifacts {
+		add("artifact_public_keys", "不能为空，确实不校验制品签名时需要设置 allow_unsigned_artifacts")
+	}
+	if _, err := c.tlsConfig(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ReleasesDir == "" {
+		add("releases_dir", "不能为空")
+	}
+	if c.ArchiveMaxSize <= 0 {
+		add("archive_max_size", "必须大于 0，当前为 %d", c.ArchiveMaxSize)
+	}
+	if dir := filepath.Clean(c.ConfigFilesDir); c.ConfigFilesDir == "" || dir == "." {
+		add("config_files_dir", "必须是单独的目录，不能是工作目录，当前为 %q", c.ConfigFilesDir)
+	} else {
+		for _, own := range c.ownFiles() {
+			if own[1] != "" && isWithin(dir, own[1]) {
+				add("config_files_dir", "不能包含更新器自己的文件 %s（%s）", own[1], own[0])
+			}
+		}
+	}
+	if !IsValidChannel(c.Channel) {
+		add("channel", "必须是 %s、%s 或 %s，当前为 %q", CHANNEL_STABLE, CHANNEL_BETA, CHANNEL_NIGHTLY, c.Channel)
+	}
+	if c.StateFile == "" {
+		add("state_file", "不能为空")
+	}
+	if c.ConfigWatchInterval != 0 && c.ConfigWatchInterval < Duration(time.Second) {
+		add("config_watch_interval", "不能小于 1s，当前为 %s", time.Duration(c.ConfigWatchInterval))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ownFiles 返回更新器自己使用的文件和目录及其配置项，发布中的附加文件不能覆盖它们
+func (c Config) ownFiles() [][2]string {
+	return [][2]string{
+		{"local_file", c.LocalFile},
+		{"version_file", c.VersionFile},
+		{"log_dir", c.LogDir},
+		{"state_file", c.StateFile},
+		{"key_store_file", c.KeyStoreFile},
+		{"tuf_root_file", c.TUFRootFile},
+		{"tuf_metadata_dir", c.TUFMetadataDir},
+		{"releases_dir", c.ReleasesDir},
+		{"secret_key_file", c.SecretKeyFile},
+		{"tls_ca_file", c.TLSCAFile},
+		{"tls_cert_file", c.TLSCertFile},
+		{"tls_key_file", c.TLSKeyFile},
+	}
+}
+
+// isWithin 判断 file 是否就是 dir 或位于 dir 之下，一个是绝对路径另一个是相对路径时无法判断，返回 false
+func isWithin(dir, file string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(file))
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// Redacted 返回隐藏了密钥的配置副本，用于打印
+func (c Config) Redacted() Config {
+	if c.SecretKey != "" {
+		c.SecretKey = "******"
+	}
+	if c.GitHubToken != "" {
+		c.GitHubToken = "******"
+	}
+	if c.SecretKeys != nil {
+		keys := make([]SecretKeyEntry, len(c.SecretKeys))
+		for i, k := range c.SecretKeys {
+			if k.Key != "" {
+				k.Key = "******"
+			}
+			keys[i] = k
+		}
+		c.SecretKeys = keys
+	}
+	return c
+}
+
+// diffConfig 列出两份配置之间变化的配置项，密钥类配置只提示已修改
+func diffConfig(old, new Config) []string {
+	var changes []string
+	ov := reflect.ValueOf(old)
+	nv := reflect.ValueOf(new)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		a, b := ov.Field(i).Interface(), nv.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		if strings.Contains(name, "secret") || strings.Contains(name, "token") {
+			changes = append(changes, fmt.Sprintf("%s 已修改", name))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, formatConfigValue(a), formatConfigValue(b)))
+	}
+	return changes
+}
+
+func formatConfigValue(v interface{}) interface{} {
+	if d, ok := v.(Duration); ok {
+		return time.Duration(d)
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Slice, reflect.Struct, reflect.Map:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+	}
+	return v
+}
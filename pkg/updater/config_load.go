@@ -0,0 +1,256 @@
+package updater
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ENV_PREFIX 配置项对应环境变量的前缀，如 api_url 对应 GO_DOWNLOAD_API_URL
+const ENV_PREFIX = "GO_DOWNLOAD_"
+
+// ConfigLoader 分层配置加载器，优先级：命令行参数 > GO_DOWNLOAD_* 环境变量 > 配置文件 > 默认值
+type ConfigLoader struct {
+	// Path 配置文件路径，为空时依次使用 --config、GO_DOWNLOAD_CONFIG 和默认路径
+	Path string
+	// Env 环境变量列表，为 nil 时使用 os.Environ()
+	Env []string
+
+	flagPath  string
+	overrides map[string]string
+}
+
+// NewConfigLoader 创建配置加载器
+func NewConfigLoader() *ConfigLoader {
+	return &ConfigLoader{overrides: make(map[string]string)}
+}
+
+// RegisterFlags 在 fs 上注册 --config 以及每个配置项对应的命令行参数（如 --api-url）
+func (l *ConfigLoader) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&l.flagPath, "config", "", "配置文件路径，支持 .json/.yaml/.yml/.toml")
+	for _, f := range configFields() {
+		fs.Var(&overrideFlag{loader: l, field: f.name}, strings.ReplaceAll(f.name, "_", "-"), "配置项 "+f.name)
+	}
+}
+
+// overrideFlag 记录命令行中显式设置的配置项，在加载时最后应用
+type overrideFlag struct {
+	loader *ConfigLoader
+	field  string
+}
+
+func (f *overrideFlag) String() string {
+	if f.loader == nil {
+		return ""
+	}
+	return f.loader.overrides[f.field]
+}
+
+// IsBoolFlag 布尔配置项可以写作 --allow-downgrade，不带值
+func (f *overrideFlag) IsBoolFlag() bool {
+	for _, cf := range configFields() {
+		if cf.name == f.field {
+			return reflect.TypeOf(Config{}).Field(cf.index).Type.Kind() == reflect.Bool
+		}
+	}
+	return false
+}
+
+func (f *overrideFlag) Set(v string) error {
+	// 先用默认配置试解析，尽早报告格式错误
+	cfg := DefaultConfig()
+	if err := setConfigField(&cfg, f.field, v); err != nil {
+		return err
+	}
+	f.loader.overrides[f.field] = v
+	return nil
+}
+
+// ConfigPath 返回实际使用的配置文件路径，以及该路径是否由用户显式指定
+func (l *ConfigLoader) ConfigPath() (string, bool) {
+	if l.Path != "" {
+		return l.Path, true
+	}
+	if l.flagPath != "" {
+		return l.flagPath, true
+	}
+	if v, ok := lookupEnv(l.environ(), ENV_PREFIX+"CONFIG"); ok && v != "" {
+		return v, true
+	}
+	return CONFIG_FILE, false
+}
+
+// Load 按优先级加载配置。显式指定的配置文件不存在或任何配置文件格式错误时返回错误
+func (l *ConfigLoader) Load() (Config, error) {
+	cfg := DefaultConfig()
+
+	path, explicit := l.ConfigPath()
+	// 默认路径下没有配置文件时只使用环境变量和命令行参数
+	if err := loadConfigFile(path, &cfg); err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		return cfg, err
+	}
+
+	env := l.environ()
+	for _, f := range configFields() {
+		key := ENV_PREFIX + strings.ToUpper(f.name)
+		v, ok := lookupEnv(env, key)
+		if !ok {
+			continue
+		}
+		if err := setConfigField(&cfg, f.name, v); err != nil {
+			return cfg, fmt.Errorf("环境变量 %s: %w", key, err)
+		}
+	}
+
+	for name, v := range l.overrides {
+		if err := setConfigField(&cfg, name, v); err != nil {
+			return cfg, fmt.Errorf("命令行参数 --%s: %w", strings.ReplaceAll(name, "_", "-"), err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (l *ConfigLoader) environ() []string {
+	if l.Env != nil {
+		return l.Env
+	}
+	return os.Environ()
+}
+
+// LoadConfigFile 读取单个配置文件，未设置的项使用默认值
+func LoadConfigFile(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if err := loadConfigFile(path, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// loadConfigFile 按扩展名解析配置文件并覆盖到 cfg 上，未知扩展名按 JSON 解析
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	loaded := *cfg
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&loaded); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("解析 YAML 配置文件 %s 失败: %v", path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), &loaded); err != nil {
+			return fmt.Errorf("解析 TOML 配置文件 %s 失败: %v", path, err)
+		}
+	default:
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("解析 JSON 配置文件 %s 失败: %v", path, err)
+		}
+	}
+
+	*cfg = loaded
+	return nil
+}
+
+// configField 可以通过环境变量和命令行参数设置的配置项
+type configField struct {
+	name  string
+	index int
+}
+
+// configFields 列出 Config 中的标量配置项，名称取自 json 标签
+func configFields() []configField {
+	var fields []configField
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || !isScalarField(f.Type) {
+			continue
+		}
+		fields = append(fields, configField{name: name, index: i})
+	}
+	return fields
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func isScalarField(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// setConfigField 按配置项名称把字符串值写入 cfg，字符串列表使用逗号分隔
+func setConfigField(cfg *Config, name, raw string) error {
+	for _, f := range configFields() {
+		if f.name != name {
+			continue
+		}
+		v := reflect.ValueOf(cfg).Elem().Field(f.index)
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := tu.UnmarshalText([]byte(raw)); err != nil {
+				return &ConfigError{Field: name, Msg: fmt.Sprintf("的值 %q 无效: %v", raw, err)}
+			}
+			return nil
+		}
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return &ConfigError{Field: name, Msg: fmt.Sprintf("的值 %q 不是有效的布尔值", raw)}
+			}
+			v.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return &ConfigError{Field: name, Msg: fmt.Sprintf("的值 %q 不是有效的整数", raw)}
+			}
+			v.SetInt(n)
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items))
+		}
+		return nil
+	}
+	return &ConfigError{Field: name, Msg: "不存在"}
+}
+
+// lookupEnv 在环境变量列表中查找 key
+func lookupEnv(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,176 @@
+package updater
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeConfigFile 在临时目录中写入配置文件
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadConfig 使用环境变量 env 和命令行参数 args 加载配置
+func loadConfig(t *testing.T, env, args []string) (Config, error) {
+	t.Helper()
+	l := NewConfigLoader()
+	l.Env = env
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return l.Load()
+}
+
+func TestConfigLoaderPrecedence(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+	"api_url": "https://file.example.com/api",
+	"user_agent": "file-agent",
+	"service_port": 8080,
+	"check_interval": "90s",
+	"proxy_prefixes": ["https://p1.example.com/", "https://p2.example.com/"]
+}`,
+		"config.yaml": `api_url: https://file.example.com/api
+user_agent: file-agent
+service_port: 8080
+check_interval: 90s
+proxy_prefixes:
+  - https://p1.example.com/
+  - https://p2.example.com/
+`,
+		"config.toml": `api_url = "https://file.example.com/api"
+user_agent = "file-agent"
+service_port = 8080
+check_interval = "90s"
+proxy_prefixes = ["https://p1.example.com/", "https://p2.example.com/"]
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfigFile(t, name, content)
+			fromFile := []string{"https://p1.example.com/", "https://p2.example.com/"}
+
+			cases := []struct {
+				layer     string
+				env, args []string
+				apiURL    string
+				agent     string
+				port      int
+				interval  time.Duration
+				prefixes  []string
+				downgrade bool
+			}{
+				{"配置文件", nil, nil, "https://file.example.com/api", "file-agent", 8080, 90 * time.Second, fromFile, false},
+				{
+					"环境变量覆盖配置文件",
+					[]string{"GO_DOWNLOAD_API_URL=https://env.example.com/api", "GO_DOWNLOAD_CHECK_INTERVAL=5m", "GO_DOWNLOAD_PROXY_PREFIXES=https://env.example.com/, ", "GO_DOWNLOAD_ALLOW_DOWNGRADE=true"},
+					nil,
+					"https://env.example.com/api", "file-agent", 8080, 5 * time.Minute, []string{"https://env.example.com/"}, true,
+				},
+				{
+					"命令行参数覆盖环境变量",
+					[]string{"GO_DOWNLOAD_API_URL=https://env.example.com/api", "GO_DOWNLOAD_SERVICE_PORT=9090", "GO_DOWNLOAD_ALLOW_DOWNGRADE=true"},
+					[]string{"--api-url", "https://flag.example.com/api", "--check-interval=1h30m", "--allow-downgrade=false"},
+					"https://flag.example.com/api", "file-agent", 9090, 90 * time.Minute, fromFile, false,
+				},
+			}
+			for _, c := range cases {
+				t.Run(c.layer, func(t *testing.T) {
+					cfg, err := loadConfig(t, append([]string{"GO_DOWNLOAD_CONFIG=" + path}, c.env...), c.args)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got := []interface{}{cfg.ApiUrl, cfg.UserAgent, cfg.ServicePort, time.Duration(cfg.CheckInterval), cfg.ProxyPrefixes, cfg.AllowDowngrade}
+					want := []interface{}{c.apiURL, c.agent, c.port, c.interval, c.prefixes, c.downgrade}
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("加载结果应为 %v，实际为 %v", want, got)
+					}
+					// 未设置的项使用默认值
+					if def := DefaultConfig(); cfg.LocalFile != def.LocalFile || cfg.ServiceCheckWait != def.ServiceCheckWait {
+						t.Fatalf("未设置的配置项应使用默认值，实际 local_file=%q service_check_wait=%v", cfg.LocalFile, cfg.ServiceCheckWait)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestConfigLoaderConfigPath(t *testing.T) {
+	envPath := writeConfigFile(t, "env.yaml", "user_agent: from-env-path\n")
+	flagPath := writeConfigFile(t, "flag.toml", "user_agent = \"from-flag-path\"\n")
+
+	cfg, err := loadConfig(t, []string{"GO_DOWNLOAD_CONFIG=" + envPath}, []string{"--config", flagPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UserAgent != "from-flag-path" {
+		t.Fatalf("--config 应优先于 GO_DOWNLOAD_CONFIG，实际 user_agent=%q", cfg.UserAgent)
+	}
+
+	// 默认路径下没有配置文件时只使用默认值
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if cfg, err := loadConfig(t, []string{}, nil); err != nil || !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Fatalf("没有配置文件时应使用默认配置: %v", err)
+	}
+}
+
+func TestConfigLoaderErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		file  string
+		body  string
+		env   []string
+		field string
+	}{
+		{name: "JSON 格式错误", file: "config.json", body: `{"api_url": `},
+		{name: "YAML 格式错误", file: "config.yaml", body: "api_url: [\n"},
+		{name: "TOML 格式错误", file: "config.toml", body: "api_url = \n"},
+		{name: "YAML 时间间隔无效", file: "config.yaml", body: "check_interval: soon\n"},
+		{name: "TOML 时间间隔无效", file: "config.toml", body: "check_interval = \"soon\"\n"},
+		{name: "JSON 类型错误", file: "config.json", body: `{"service_port": "8080"}`},
+		{name: "环境变量不是整数", file: "config.json", body: `{}`, env: []string{"GO_DOWNLOAD_SERVICE_PORT=http"}, field: "service_port"},
+		{name: "环境变量不是布尔值", file: "config.json", body: `{}`, env: []string{"GO_DOWNLOAD_ALLOW_CBC=maybe"}, field: "allow_cbc"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := writeConfigFile(t, c.file, c.body)
+			_, err := loadConfig(t, append([]string{"GO_DOWNLOAD_CONFIG=" + path}, c.env...), nil)
+			if err == nil {
+				t.Fatal("应返回错误，不应退回默认配置")
+			}
+			if c.field != "" && !configErrorFields(err)[c.field] {
+				t.Fatalf("错误应指出配置项 %s，实际错误: %v", c.field, err)
+			}
+		})
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if _, err := loadConfig(t, []string{"GO_DOWNLOAD_CONFIG=" + missing}, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("显式指定的配置文件不存在时应返回错误，实际错误: %v", err)
+	}
+
+	// 命令行参数的格式错误在解析时报告
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	NewConfigLoader().RegisterFlags(fs)
+	if err := fs.Parse([]string{"--check-interval", "soon"}); err == nil {
+		t.Fatal("--check-interval 的值无效时应返回错误")
+	}
+}
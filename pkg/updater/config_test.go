@@ -0,0 +1,140 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// configErrorFields 返回配置校验错误中出错的配置项
+func configErrorFields(err error) map[string]bool {
+	fields := map[string]bool{}
+	var walk func(error)
+	walk = func(err error) {
+		var cfgErr *ConfigError
+		if errors.As(err, &cfgErr) {
+			fields[cfgErr.Field] = true
+		}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				walk(e)
+			}
+		}
+	}
+	walk(err)
+	return fields
+}
+
+func TestValidateTUFSource(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TUFMetadataUrl = "https://example.com/metadata/"
+	cfg.TUFRootFile = "root.json"
+	cfg.AllowUnsignedArtifacts = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("api 更新源使用 TUF 元数据时不需要 api_url 和共享密钥: %v", err)
+	}
+
+	cfg.Source = SOURCE_STATIC
+	cfg.SourceURL = "https://example.com/manifest.json"
+	if fields := configErrorFields(cfg.Validate()); !fields["tuf_metadata_url"] {
+		t.Fatalf("static 更新源设置 tuf_metadata_url 时配置校验应失败，实际出错的配置项: %v", fields)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	old := DefaultConfig()
+	old.SecretKey = "old-secret-0000"
+
+	cases := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   []string
+	}{
+		{"没有变化", func(cfg *Config) {}, nil},
+		{"时间间隔", func(cfg *Config) { cfg.CheckInterval = Duration(90 * time.Second) }, []string{"check_interval: 12h0m0s -> 1m30s"}},
+		{"字符串和整数", func(cfg *Config) {
+			cfg.ApiUrl = "https://new.example.com/api"
+			cfg.ServicePort = 8080
+		}, []string{"api_url:  -> https://new.example.com/api", "service_port: 35455 -> 8080"}},
+		{"列表", func(cfg *Config) { cfg.ProxyPrefixes = []string{"https://p.example.com/"} }, []string{`proxy_prefixes: null -> ["https://p.example.com/"]`}},
+		{"密钥不输出内容", func(cfg *Config) {
+			cfg.SecretKey = "new-secret-0000"
+			cfg.GitHubToken = "ghp_new"
+		}, []string{"secret_key 已修改", "github_token 已修改"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := old
+			c.modify(&cfg)
+			if got := diffConfig(old, cfg); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("变更应为 %q，实际为 %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestReloadAppliesConfig(t *testing.T) {
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.ApiUrl = "https://old.example.com/api"
+		cfg.SecretKey = testSecretKey
+		cfg.AllowUnsignedManifest = true
+	})
+
+	invalid := u.Config()
+	invalid.ServicePort = 0
+	if err := u.Reload(invalid); !configErrorFields(err)["service_port"] {
+		t.Fatalf("无效的配置应被拒绝，实际错误: %v", err)
+	}
+
+	next := u.Config()
+	next.ApiUrl = "https://new.example.com/api"
+	next.CheckInterval = Duration(time.Minute)
+	next.SecretKey = ""
+	next.SecretKeys = []SecretKeyEntry{{ID: "k2", Key: "fedcba9876543210"}}
+	if err := u.Reload(next); err != nil {
+		t.Fatal(err)
+	}
+	if u.Config().ApiUrl != "https://old.example.com/api" {
+		t.Fatal("提交的配置应在当前检查结束后才生效")
+	}
+
+	u.applyConfig(<-u.reloadCh)
+	cfg := u.Config()
+	if cfg.ApiUrl != "https://new.example.com/api" || cfg.CheckInterval != Duration(time.Minute) {
+		t.Fatalf("应用后应使用新配置，实际 api_url=%s check_interval=%v", cfg.ApiUrl, time.Duration(cfg.CheckInterval))
+	}
+	signing, err := u.signingKey()
+	if err != nil || signing.id != "k2" {
+		t.Fatalf("应用后应使用新的密钥签名，实际为 %q: %v", signing.id, err)
+	}
+}
+
+func TestConfigTemplate(t *testing.T) {
+	cfg, err := LoadConfigFile(filepath.Join("..", "..", "config_template.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模板的 _comment 列出的必填项就是配置校验报告的全部配置项
+	want := map[string]bool{"api_url": true, "secret_key": true, "manifest_public_keys": true, "artifact_public_keys": true}
+	if fields := configErrorFields(cfg.Validate()); !reflect.DeepEqual(fields, want) {
+		t.Fatalf("模板需要填写的配置项应为 %v，实际为 %v", want, fields)
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ApiUrl = "https://update.example.com/api/version"
+	cfg.SecretKey = testSecretKey
+	cfg.ManifestPublicKeys = []string{base64.StdEncoding.EncodeToString(pub)}
+	cfg.ArtifactPublicKeys = []string{newTestMinisignKey(t).publicKey()}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("填写必填项后模板应通过配置校验: %v", err)
+	}
+}
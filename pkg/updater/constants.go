@@ -1,50 +1,28 @@
 package updater
 
 import (
-	"encoding/json"
-	"os"
 	"time"
 )
 
+// 默认运行参数，均可在配置文件中覆盖
 const (
-	CHECK_INTERVAL = 12 * time.Hour
-	LOCAL_FILE     = "./allinone"
-	VERSION_FILE   = "./version.txt"
-	LOG_DIR        = "./logs"
-	CONFIG_FILE    = "./config.json"
+	CHECK_INTERVAL     = 12 * time.Hour
+	LOCAL_FILE         = "./allinone"
+	VERSION_FILE       = "./version.txt"
+	LOG_DIR            = "./logs"
+	CONFIG_FILE        = "./config.json"
+	KEY_STORE_FILE     = "./keys.json"
+	TUF_METADATA_DIR   = "./metadata"
+	STATE_FILE         = "./state.json"
+	RELEASES_DIR       = "./releases"
+	ARCHIVE_MAX_SIZE   = 1 << 30
+	CONFIG_FILES_DIR   = "./conf"
+	SERVICE_PORT       = 35455
+	PROXY_PREFIX       = "https://ghp.ci/"
+	USER_AGENT         = "MyTV/1.0"
+	PROCESS_NAME       = "download_all"
+	SERVICE_CHECK_WAIT = 90 * time.Second
+	PORT_RELEASE_WAIT  = 20 * time.Second
+	REQUEST_TIMEOUT    = 30 * time.Second
+	DOWNLOAD_TIMEOUT   = 60 * time.Second
 )
-
-var (
-	API_URL    string
-	SECRET_KEY string
-)
-
-type Config struct {
-	ApiUrl    string `json:"api_url"`
-	SecretKey string `json:"secret_key"`
-}
-
-func init() {
-	config := loadConfig()
-	API_URL = config.ApiUrl
-	SECRET_KEY = config.SecretKey
-}
-
-func loadConfig() Config {
-	config := Config{
-		// 默认值
-		ApiUrl:    "",
-		SecretKey: "",
-	}
-
-	data, err := os.ReadFile(CONFIG_FILE)
-	if err != nil {
-		return config
-	}
-
-	if err := json.Unmarshal(data, &config); err != nil {
-		return config
-	}
-
-	return config
-}
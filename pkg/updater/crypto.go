@@ -4,37 +4,107 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"time"
+	"net/http"
+	"strconv"
+	"strings"
 )
 
-// GenerateHeaders 生成请求头
-func GenerateHeaders() (*Headers, error) {
-	currentTime := time.Now()
+// 请求签名版本
+const (
+	SIGN_VERSION_MD5  = 1
+	SIGN_VERSION_HMAC = 2
+)
+
+// GenerateHeaders 为请求生成签名头。
+//
+// 签名版本 2 使用 HMAC-SHA256，签名内容为以换行分隔的请求方法、请求路径（含查询参数）、
+// 时间戳、随机 nonce 和请求体的 SHA-256（hex），服务器可以据此拒绝重放的 nonce；
+// 签名版本 1 为旧的 md5(密钥 + 时间戳)，仅用于兼容旧服务器。
+// 使用 secret_keys 中的密钥签名时通过 X-Key-Id 告知服务器密钥 ID
+func (u *Updater) GenerateHeaders(method, uri string, body []byte) (*Headers, error) {
+	currentTime := u.now()
 	timestamp := fmt.Sprintf("%d", currentTime.Unix())
 
-	// 生成签名
-	content := SECRET_KEY + timestamp
-	hash := md5.Sum([]byte(content))
-	sign := hex.EncodeToString(hash[:])
+	signing, err := u.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if u.cfg.SignVersion == SIGN_VERSION_MD5 {
+		// 生成签名
+		content := string(signing.key) + timestamp
+		hash := md5.Sum([]byte(content))
+		sign := hex.EncodeToString(hash[:])
+
+		// 打印加密后的日志
+		u.logf("签名内容(加密): %s", encryptLogContent(signing.key, content))
+		u.logf("生成的签名(加密): %s", encryptLogContent(signing.key, sign))
+
+		return &Headers{
+			Version:   SIGN_VERSION_MD5,
+			KeyID:     signing.id,
+			Timestamp: timestamp,
+			Sign:      sign,
+		}, nil
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, fmt.Errorf("生成 nonce 失败: %v", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	bodyHash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(bodyHash[:])
+
+	content := strings.Join([]string{strings.ToUpper(method), uri, timestamp, nonce, contentHash}, "\n")
+	mac := hmac.New(sha256.New, signing.key)
+	mac.Write([]byte(content))
+	sign := hex.EncodeToString(mac.Sum(nil))
 
-	// 打印加密后的日志
-	Logf("签名内容(加密): %s", encryptLogContent(content))
-	Logf("生成的签名(加密): %s", encryptLogContent(sign))
+	u.logf("签名内容(加密): %s", encryptLogContent(signing.key, content))
 
 	return &Headers{
-		Timestamp: timestamp,
-		Sign:      sign,
+		Version:     SIGN_VERSION_HMAC,
+		KeyID:       signing.id,
+		Timestamp:   timestamp,
+		Nonce:       nonce,
+		ContentHash: contentHash,
+		Sign:        sign,
 	}, nil
 }
 
+// signRequest 为请求生成签名并写入请求头，body 为请求体（没有时传 nil）
+func (u *Updater) signRequest(req *http.Request, body []byte) error {
+	headers, err := u.GenerateHeaders(req.Method, req.URL.RequestURI(), body)
+	if err != nil {
+		return fmt.Errorf("生成请求头失败: %v", err)
+	}
+
+	req.Header.Set("X-Timestamp", headers.Timestamp)
+	req.Header.Set("X-Sign", headers.Sign)
+	if headers.KeyID != "" {
+		req.Header.Set("X-Key-Id", headers.KeyID)
+	}
+	if headers.Version != SIGN_VERSION_MD5 {
+		req.Header.Set("X-Sign-Version", strconv.Itoa(headers.Version))
+		req.Header.Set("X-Nonce", headers.Nonce)
+		req.Header.Set("X-Content-SHA256", headers.ContentHash)
+	}
+	req.Header.Set("User-Agent", u.cfg.UserAgent)
+	return nil
+}
+
 // encryptLogContent 加密日志内容
-func encryptLogContent(content string) string {
+func encryptLogContent(key []byte, content string) string {
 	// 创建 AES 密码块
-	block, err := aes.NewCipher([]byte(SECRET_KEY))
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return fmt.Sprintf("[ENCRYPT_ERROR:%v]", err)
 	}
@@ -56,8 +126,59 @@ func encryptLogContent(content string) string {
 	return base64.StdEncoding.EncodeToString(encrypted)
 }
 
+// ENVELOPE_VERSION_GCM AES-GCM 密文信封的版本字节。
+// 信封格式为：版本字节(1) + nonce(12) + 密文和认证标签，版本字节同时作为附加认证数据
+const ENVELOPE_VERSION_GCM = 0x02
+
+// decryptManifest 解密版本信息。优先按 AES-GCM 信封依次尝试 keys 中的密钥，认证失败时直接拒绝；
+// 仅在 allowCBC 为 true 时使用第一个密钥回退到旧的 AES-CBC 格式
+func decryptManifest(keys [][]byte, data []byte, allowCBC bool) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("没有当前有效的共享密钥")
+	}
+	if len(data) > 0 && data[0] == ENVELOPE_VERSION_GCM {
+		var err error
+		for _, key := range keys {
+			var plain []byte
+			if plain, err = decryptAESGCM(key, data); err == nil {
+				return plain, nil
+			}
+		}
+		if !allowCBC {
+			return nil, err
+		}
+	} else if !allowCBC {
+		return nil, fmt.Errorf("不支持的密文格式，旧服务器的 AES-CBC 格式需要设置 allow_cbc")
+	}
+	return decryptAESCBC(keys[0], data)
+}
+
+// decryptAESGCM 解密 AES-GCM 信封
+func decryptAESGCM(key, envelope []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envelope) < 1+gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("密文太短")
+	}
+	nonce := envelope[1 : 1+gcm.NonceSize()]
+	ciphertext := envelope[1+gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, ciphertext, envelope[:1])
+	if err != nil {
+		return nil, fmt.Errorf("密文认证失败，响应可能被篡改")
+	}
+	return plain, nil
+}
+
 // decryptAESCBC AES解密
-func decryptAESCBC(encryptedData []byte) ([]byte, error) {
+func decryptAESCBC(key []byte, encryptedData []byte) ([]byte, error) {
 	if len(encryptedData) < aes.BlockSize {
 		return nil, fmt.Errorf("密文太短")
 	}
@@ -67,7 +188,6 @@ func decryptAESCBC(encryptedData []byte) ([]byte, error) {
 	ciphertext := encryptedData[aes.BlockSize:]
 
 	// 使用密钥创建cipher
-	key := []byte(SECRET_KEY)
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
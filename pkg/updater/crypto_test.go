@@ -0,0 +1,180 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testSecretKey = "0123456789abcdef"
+
+func TestSignRequestHMAC(t *testing.T) {
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.ApiUrl = "https://update.example.com/api/version"
+		cfg.SecretKey = testSecretKey
+		cfg.AllowUnsignedManifest = true
+	})
+
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		body   []byte
+		uri    string
+	}{
+		{"GET 无请求体", http.MethodGet, "https://update.example.com/api/version", nil, "/api/version"},
+		{"查询参数参与签名", http.MethodGet, "https://update.example.com/api/version?channel=beta&os=linux", nil, "/api/version?channel=beta&os=linux"},
+		{"POST 请求体", http.MethodPost, "https://update.example.com/api/report", []byte(`{"version":"1.2.0"}`), "/api/report"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := http.NewRequest(c.method, c.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := u.signRequest(req, c.body); err != nil {
+				t.Fatal(err)
+			}
+			h := req.Header
+			if h.Get("X-Sign-Version") != strconv.Itoa(SIGN_VERSION_HMAC) || len(h.Get("X-Nonce")) != 32 {
+				t.Fatalf("缺少签名版本或 nonce: %v", h)
+			}
+			bodyHash := sha256.Sum256(c.body)
+			if h.Get("X-Content-SHA256") != hex.EncodeToString(bodyHash[:]) {
+				t.Fatalf("请求体摘要应为 %x，实际为 %s", bodyHash, h.Get("X-Content-SHA256"))
+			}
+
+			content := strings.Join([]string{c.method, c.uri, h.Get("X-Timestamp"), h.Get("X-Nonce"), h.Get("X-Content-SHA256")}, "\n")
+			mac := hmac.New(sha256.New, []byte(testSecretKey))
+			mac.Write([]byte(content))
+			if want := hex.EncodeToString(mac.Sum(nil)); h.Get("X-Sign") != want {
+				t.Fatalf("签名内容 %q 的签名应为 %s，实际为 %s", content, want, h.Get("X-Sign"))
+			}
+		})
+	}
+
+	// 每个请求使用不同的 nonce
+	a, _ := u.GenerateHeaders(http.MethodGet, "/api/version", nil)
+	b, _ := u.GenerateHeaders(http.MethodGet, "/api/version", nil)
+	if a.Nonce == b.Nonce || a.Sign == b.Sign {
+		t.Fatal("相同请求的 nonce 和签名不应重复")
+	}
+}
+
+func TestSignRequestMD5Fallback(t *testing.T) {
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.ApiUrl = "https://update.example.com/api/version"
+		cfg.SecretKeys = []SecretKeyEntry{{ID: "k1", Key: testSecretKey}}
+		cfg.SignVersion = SIGN_VERSION_MD5
+		cfg.AllowUnsignedManifest = true
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "https://update.example.com/api/version", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.signRequest(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	h := req.Header
+	sum := md5.Sum([]byte(testSecretKey + h.Get("X-Timestamp")))
+	if h.Get("X-Sign") != hex.EncodeToString(sum[:]) {
+		t.Fatalf("签名应为 md5(密钥 + 时间戳) %x，实际为 %s", sum, h.Get("X-Sign"))
+	}
+	if h.Get("X-Key-Id") != "k1" {
+		t.Fatalf("应通过 X-Key-Id 告知密钥 ID，实际为 %q", h.Get("X-Key-Id"))
+	}
+	for _, name := range []string{"X-Sign-Version", "X-Nonce", "X-Content-SHA256"} {
+		if h.Get(name) != "" {
+			t.Fatalf("旧的签名版本不应发送 %s", name)
+		}
+	}
+}
+
+// sealGCM 按服务器的格式生成 AES-GCM 信封
+func sealGCM(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := make([]byte, 1+gcm.NonceSize())
+	envelope[0] = ENVELOPE_VERSION_GCM
+	if _, err := rand.Read(envelope[1:]); err != nil {
+		t.Fatal(err)
+	}
+	return gcm.Seal(envelope, envelope[1:], plain, envelope[:1])
+}
+
+// sealCBC 按旧服务器的格式生成 IV + AES-CBC 密文
+func sealCBC(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, aes.BlockSize+len(data))
+	// 固定使用不以版本字节开头的 IV，避免被当作 GCM 信封
+	copy(out, bytes.Repeat([]byte{0x10}, aes.BlockSize))
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], data)
+	return out
+}
+
+func TestDecryptManifest(t *testing.T) {
+	key := []byte(testSecretKey)
+	other := []byte("fedcba9876543210")
+	plain := []byte(`{"version":"1.2.0"}`)
+
+	envelope := sealGCM(t, key, plain)
+	flipped := append([]byte{}, envelope...)
+	flipped[len(flipped)-1] ^= 0x01
+	nonceTampered := append([]byte{}, envelope...)
+	nonceTampered[1] ^= 0x01
+	cbc := sealCBC(t, key, plain)
+
+	cases := []struct {
+		name     string
+		keys     [][]byte
+		data     []byte
+		allowCBC bool
+		ok       bool
+	}{
+		{"GCM", [][]byte{key}, envelope, false, true},
+		{"GCM 依次尝试密钥", [][]byte{other, key}, envelope, false, true},
+		{"GCM 密文被修改", [][]byte{key}, flipped, false, false},
+		{"GCM nonce 被修改", [][]byte{key}, nonceTampered, false, false},
+		{"GCM 密钥错误", [][]byte{other}, envelope, false, false},
+		{"GCM 密文太短", [][]byte{key}, envelope[:20], false, false},
+		{"没有密钥", nil, envelope, false, false},
+		{"未设置 allow_cbc 时拒绝 CBC", [][]byte{key}, cbc, false, false},
+		{"设置 allow_cbc 时接受 CBC", [][]byte{key}, cbc, true, true},
+		{"CBC 密钥错误", [][]byte{other}, cbc, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := decryptManifest(c.keys, c.data, c.allowCBC)
+			if c.ok {
+				if err != nil || !bytes.Equal(got, plain) {
+					t.Fatalf("应解密成功: %q, %v", got, err)
+				}
+			} else if err == nil {
+				t.Fatalf("应拒绝解密，实际得到 %q", got)
+			}
+		})
+	}
+}
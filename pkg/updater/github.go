@@ -0,0 +1,425 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// GITHUB_API_URL GitHub 接口地址，GitHub Enterprise 为 https://<主机>/api/v3
+const GITHUB_API_URL = "https://api.github.com"
+
+// GITHUB_RELEASES_PER_PAGE 允许先行版本时获取的最近发布数量
+const GITHUB_RELEASES_PER_PAGE = 30
+
+// GITHUB_SIGNATURE_SUFFIX 附件的 minisign 签名文件的后缀，如 download_allinone_linux_arm64_1.2.0.minisig
+const GITHUB_SIGNATURE_SUFFIX = ".minisig"
+
+// githubChecksumAssets 发布中 sha256sum 格式的摘要文件名称，build.sh 生成 SHA256SUMS.txt
+var githubChecksumAssets = []string{"SHA256SUMS.txt", "SHA256SUMS"}
+
+// GitHubRelease GitHub Releases 接口返回的发布信息中用到的字段
+type GitHubRelease struct {
+	TagName    string        `json:"tag_name"`
+	Name       string        `json:"name"`
+	Draft      bool          `json:"draft"`
+	Prerelease bool          `json:"prerelease"`
+	Assets     []GitHubAsset `json:"assets"`
+}
+
+// GitHubAsset 发布中的一个附件
+type GitHubAsset struct {
+	Name string `json:"name"`
+	// URL 接口地址，带 Accept: application/octet-stream 请求时返回附件内容，私有仓库只能通过它下载
+	URL                string `json:"url"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	Size               int64  `json:"size"`
+	// Digest 附件摘要，如 sha256:<hex>，旧的发布没有该字段
+	Digest string `json:"digest,omitempty"`
+}
+
+// githubOSNames 和 githubArchNames 没有配置 github_asset_pattern 时附件名称中可以识别的系统和架构
+var (
+	githubOSNames   = []string{"linux", "darwin", "windows", "freebsd"}
+	githubArchNames = []string{"amd64", "arm64", "arm", "386", "riscv64", "mips", "mipsle"}
+)
+
+// githubPatternFields github_asset_pattern 中的占位符及其匹配的内容
+var githubPatternFields = map[string]string{
+	"os":      `[a-z0-9]+`,
+	"arch":    `[a-z0-9]+`,
+	"variant": `v[0-9]+`,
+	"libc":    `glibc|musl`,
+}
+
+// githubPatternToken github_asset_pattern 中的占位符和通配符
+var githubPatternToken = regexp.MustCompile(`\{(os|arch|variant|libc|version)\}|\*`)
+
+// githubSource GitHub Releases 更新源
+type githubSource struct {
+	u *Updater
+	// url 设置了 source_url 且没有设置 github_repo 时直接使用的发布接口地址
+	url     string
+	api     *url.URL
+	repo    string
+	tag     string
+	channel string
+	// prerelease 允许任何先行版本，不按发布频道筛选
+	prerelease bool
+	token      string
+	pattern    string
+	// signed 配置了 artifact_public_keys，需要获取附件的 minisign 签名
+	signed bool
+}
+
+// newGitHubSource 按配置创建 GitHub 更新源，按发布频道筛选先行版本
+func (u *Updater) newGitHubSource() (*githubSource, error) {
+	api, err := url.Parse(strings.TrimSuffix(u.cfg.GitHubAPIUrl, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("GitHub 接口地址无效: %v", err)
+	}
+	return &githubSource{
+		u:          u,
+		url:        u.cfg.SourceURL,
+		api:        api,
+		repo:       u.cfg.GitHubRepo,
+		tag:        u.cfg.GitHubTag,
+		channel:    u.Channel(),
+		prerelease: u.cfg.GitHubPrerelease,
+		token:      u.cfg.GitHubToken,
+		pattern:    u.cfg.GitHubAssetPattern,
+		signed:     len(u.cfg.ArtifactPublicKeys) > 0,
+	}, nil
+}
+
+func (s *githubSource) Latest() (*VersionInfo, error) {
+	release, err := s.release()
+	if err != nil {
+		return nil, err
+	}
+	s.u.logf("使用 GitHub 发布 %s", release.TagName)
+	return s.versionInfo(release)
+}
+
+// Fetch 下载附件。只有请求 GitHub 接口本身时才带上令牌，经过代理前缀或其他镜像的请求不带令牌
+func (s *githubSource) Fetch(rawURL string) (io.ReadCloser, error) {
+	return s.u.httpFetch(rawURL, s.assetHeader(rawURL))
+}
+
+// assetHeader 返回下载附件的请求头
+func (s *githubSource) assetHeader(rawURL string) http.Header {
+	header := http.Header{}
+	if s.isAPI(rawURL) {
+		header.Set("Accept", "application/octet-stream")
+		s.authorize(header)
+	}
+	return header
+}
+
+// release 获取指定标签、最新的正式版本，或当前频道可以使用的版本号最高的发布
+func (s *githubSource) release() (*GitHubRelease, error) {
+	if s.repo == "" {
+		return s.getRelease(s.url)
+	}
+	base := s.api.String() + "/repos/" + s.repo + "/releases"
+	switch {
+	case s.tag != "":
+		return s.getRelease(base + "/tags/" + url.PathEscape(s.tag))
+	case !s.prerelease && s.channel == CHANNEL_STABLE:
+		return s.getRelease(base + "/latest")
+	}
+
+	data, err := s.get(fmt.Sprintf("%s?per_page=%d", base, GITHUB_RELEASES_PER_PAGE))
+	if err != nil {
+		return nil, err
+	}
+	var releases []GitHubRelease
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("解析 GitHub 发布列表失败: %v", err)
+	}
+	var best *GitHubRelease
+	var bestVersion SemVer
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft {
+			continue
+		}
+		v, err := ParseVersion(r.TagName)
+		if err != nil {
+			continue
+		}
+		if !s.prerelease && !channelIncludes(s.channel, githubReleaseChannel(r, v)) {
+			continue
+		}
+		if best == nil || v.Compare(bestVersion) > 0 {
+			best, bestVersion = r, v
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("仓库 %s 没有 %s 频道可以使用的发布", s.repo, s.channel)
+	}
+	return best, nil
+}
+
+// githubReleaseChannel 返回发布所属的频道：版本号的先行标识符为 beta 或 rc 时属于 beta，
+// 为其他标识符（如 nightly、alpha、dev）时属于 nightly；没有先行标识符但标记为 prerelease 的发布属于 beta
+func githubReleaseChannel(r *GitHubRelease, v SemVer) string {
+	if len(v.Pre) == 0 {
+		if r.Prerelease {
+			return CHANNEL_BETA
+		}
+		return CHANNEL_STABLE
+	}
+	switch strings.ToLower(v.Pre[0]) {
+	case "beta", "rc":
+		return CHANNEL_BETA
+	}
+	return CHANNEL_NIGHTLY
+}
+
+// channelIncludes 判断频道是否可以使用 release 频道的发布：stable 只使用正式版本，
+// beta 还使用 beta 版本，nightly 使用所有版本
+func channelIncludes(channel, release string) bool {
+	rank := map[string]int{CHANNEL_STABLE: 0, CHANNEL_BETA: 1, CHANNEL_NIGHTLY: 2}
+	return rank[release] <= rank[channel]
+}
+
+// getRelease 获取单个发布
+func (s *githubSource) getRelease(rawURL string) (*GitHubRelease, error) {
+	data, err := s.get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var release GitHubRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("解析 GitHub 发布信息失败: %v", err)
+	}
+	return &release, nil
+}
+
+// get 请求 GitHub 接口
+func (s *githubSource) get(rawURL string) ([]byte, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	s.authorize(header)
+	return s.u.httpGet(rawURL, header, MAX_MANIFEST_SIZE)
+}
+
+// authorize 配置了令牌时加入认证请求头
+func (s *githubSource) authorize(header http.Header) {
+	if s.token != "" {
+		header.Set("Authorization", "Bearer "+s.token)
+	}
+}
+
+// isAPI 判断地址是否指向 GitHub 接口
+func (s *githubSource) isAPI(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == s.api.Scheme && u.Host == s.api.Host && strings.HasPrefix(u.Path, s.api.Path+"/")
+}
+
+// versionInfo 将发布转换为版本信息，按附件名称识别平台填入 artifacts
+func (s *githubSource) versionInfo(release *GitHubRelease) (*VersionInfo, error) {
+	version, err := ParseVersion(release.TagName)
+	if err != nil {
+		return nil, fmt.Errorf("GitHub 发布的标签 %q 不是有效的版本号: %v", release.TagName, err)
+	}
+	info := &VersionInfo{
+		Version:   strings.TrimPrefix(release.TagName, "v"),
+		Artifacts: map[string]Artifact{},
+	}
+
+	match := githubAssetPlatform
+	if s.pattern != "" {
+		re, err := compileAssetPattern(s.pattern, version)
+		if err != nil {
+			return nil, err
+		}
+		match = func(name string) string { return matchAssetPattern(re, name) }
+	}
+	sums, err := s.checksums(release)
+	if err != nil {
+		return nil, err
+	}
+	assets := make(map[string]GitHubAsset, len(release.Assets))
+	for _, asset := range release.Assets {
+		assets[asset.Name] = asset
+	}
+	for _, asset := range release.Assets {
+		if strings.HasSuffix(asset.Name, GITHUB_SIGNATURE_SUFFIX) {
+			continue
+		}
+		key := match(asset.Name)
+		if key == "" {
+			continue
+		}
+		if _, ok := info.Artifacts[key]; ok {
+			s.u.logf("附件 %s 与已有附件的平台 %s 相同，已忽略", asset.Name, key)
+			continue
+		}
+		artifact, err := s.artifact(asset, sums[asset.Name])
+		if err != nil {
+			return nil, err
+		}
+		if sig, ok := assets[asset.Name+GITHUB_SIGNATURE_SUFFIX]; ok && s.signed {
+			data, err := s.download(sig)
+			if err != nil {
+				return nil, fmt.Errorf("下载签名 %s 失败: %v", sig.Name, err)
+			}
+			artifact.Signature = string(data)
+		}
+		info.Artifacts[key] = artifact
+	}
+	if len(info.Artifacts) == 0 {
+		return nil, fmt.Errorf("GitHub 发布 %s 中没有可以识别平台的附件", release.TagName)
+	}
+	return info, nil
+}
+
+// artifact 将附件转换为制品，sum 为摘要文件中该附件的 SHA-256。配置了令牌时通过接口地址下载，以支持私有仓库
+func (s *githubSource) artifact(a GitHubAsset, sum string) (Artifact, error) {
+	artifact := Artifact{URL: a.BrowserDownloadURL, Size: a.Size, SHA256: sum}
+	if s.token != "" && a.URL != "" {
+		artifact.URL = a.URL
+		artifact.Mirrors = []string{a.BrowserDownloadURL}
+	}
+	if digest, ok := strings.CutPrefix(a.Digest, "sha256:"); ok {
+		if sum != "" && !strings.EqualFold(sum, digest) {
+			return artifact, fmt.Errorf("%w: 附件 %s 的 digest 与摘要文件中的 SHA-256 不一致", ErrArtifactMismatch, a.Name)
+		}
+		artifact.SHA256 = digest
+	}
+	return artifact, nil
+}
+
+// checksums 下载发布中的摘要文件，返回附件名称到 SHA-256 的映射，没有摘要文件时返回空映射
+func (s *githubSource) checksums(release *GitHubRelease) (map[string]string, error) {
+	for _, name := range githubChecksumAssets {
+		for _, asset := range release.Assets {
+			if asset.Name != name {
+				continue
+			}
+			data, err := s.download(asset)
+			if err != nil {
+				return nil, fmt.Errorf("下载摘要文件 %s 失败: %v", name, err)
+			}
+			return parseChecksums(data), nil
+		}
+	}
+	return map[string]string{}, nil
+}
+
+// download 下载较小的附件，如摘要文件和签名
+func (s *githubSource) download(a GitHubAsset) ([]byte, error) {
+	rawURL := a.BrowserDownloadURL
+	if s.token != "" && a.URL != "" {
+		rawURL = a.URL
+	}
+	return s.u.httpGet(rawURL, s.assetHeader(rawURL), MAX_MANIFEST_SIZE)
+}
+
+// parseChecksums 解析 sha256sum 格式的摘要文件（<hex>  <文件名>，二进制模式的文件名带 * 前缀），
+// 忽略空行、# 开头的注释和无法识别的行
+func parseChecksums(data []byte) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if sum, err := hex.DecodeString(fields[0]); err != nil || len(sum) != sha256.Size {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums
+}
+
+// githubAssetPlatform 从附件名称中识别 os/arch（如 download_allinone_linux_arm64_1.2.0），
+// 无法识别时返回空串
+func githubAssetPlatform(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	var goos, goarch string
+	for _, f := range fields {
+		for _, o := range githubOSNames {
+			if f == o && goos == "" {
+				goos = o
+			}
+		}
+		for _, a := range githubArchNames {
+			if f == a && goarch == "" {
+				goarch = a
+			}
+		}
+	}
+	if goos == "" || goarch == "" {
+		return ""
+	}
+	return goos + "/" + goarch
+}
+
+// compileAssetPattern 将附件名称模式转换为正则表达式。模式中 {os}、{arch}、{variant}、{libc}
+// 匹配对应的平台字段，{version} 匹配发布的版本号（可以带 v 前缀），* 匹配任意字符
+func compileAssetPattern(pattern string, version SemVer) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range githubPatternToken.FindAllStringSubmatchIndex(pattern, -1) {
+		b.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		last = loc[1]
+		if loc[2] < 0 {
+			b.WriteString(".*")
+			continue
+		}
+		switch field := pattern[loc[2]:loc[3]]; field {
+		case "version":
+			b.WriteString("v?" + regexp.QuoteMeta(version.String()))
+		default:
+			fmt.Fprintf(&b, "(?P<%s>%s)", field, githubPatternFields[field])
+		}
+	}
+	b.WriteString(regexp.QuoteMeta(pattern[last:]))
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("附件名称模式 %q 无效: %v", pattern, err)
+	}
+	if re.SubexpIndex("os") < 0 || re.SubexpIndex("arch") < 0 {
+		return nil, fmt.Errorf("附件名称模式 %q 必须包含 {os} 和 {arch}", pattern)
+	}
+	return re, nil
+}
+
+// matchAssetPattern 按附件名称模式识别 os/arch[/variant][/libc]，不匹配时返回空串
+func matchAssetPattern(re *regexp.Regexp, name string) string {
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	var p Platform
+	for i, field := range re.SubexpNames() {
+		switch field {
+		case "os":
+			p.OS = m[i]
+		case "arch":
+			p.Arch = m[i]
+		case "variant":
+			p.Variant = m[i]
+		case "libc":
+			p.Libc = m[i]
+		}
+	}
+	return p.String()
+}
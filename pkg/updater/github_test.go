@@ -0,0 +1,242 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitHub 提供 Releases 接口和附件下载的本地替身服务
+type fakeGitHub struct {
+	t        *testing.T
+	srv      *httptest.Server
+	token    string
+	releases []GitHubRelease
+	files    map[string][]byte
+
+	mu sync.Mutex
+	// leaked 收到了带令牌请求的非接口地址
+	leaked []string
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	g := &fakeGitHub{t: t, files: map[string][]byte{}}
+	g.srv = httptest.NewServer(g)
+	t.Cleanup(g.srv.Close)
+	return g
+}
+
+// addRelease 发布一个版本，withDigest 为 false 时附件没有 digest 字段，与旧的发布一样
+func (g *fakeGitHub) addRelease(tag string, prerelease, withDigest bool, files map[string][]byte) {
+	r := GitHubRelease{TagName: tag, Name: tag, Prerelease: prerelease}
+	for name, data := range files {
+		key := tag + "/" + name
+		g.files[key] = data
+		asset := GitHubAsset{
+			Name:               name,
+			URL:                g.srv.URL + "/api/v3/repos/acme/allinone/releases/assets/" + key,
+			BrowserDownloadURL: g.srv.URL + "/download/" + key,
+			Size:               int64(len(data)),
+		}
+		if withDigest {
+			sum := sha256.Sum256(data)
+			asset.Digest = "sha256:" + hex.EncodeToString(sum[:])
+		}
+		r.Assets = append(r.Assets, asset)
+	}
+	// 接口按发布时间倒序返回
+	g.releases = append([]GitHubRelease{r}, g.releases...)
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const api = "/api/v3/repos/acme/allinone/releases"
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/download/"):
+		if r.Header.Get("Authorization") != "" {
+			g.mu.Lock()
+			g.leaked = append(g.leaked, path)
+			g.mu.Unlock()
+		}
+		g.serveFile(w, r, strings.TrimPrefix(path, "/download/"))
+	case strings.HasPrefix(path, api+"/assets/"):
+		if r.Header.Get("Authorization") != "Bearer "+g.token || r.Header.Get("Accept") != "application/octet-stream" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		g.serveFile(w, r, strings.TrimPrefix(path, api+"/assets/"))
+	case path == api+"/latest":
+		for _, rel := range g.releases {
+			if !rel.Prerelease && !rel.Draft {
+				g.writeJSON(w, rel)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case strings.HasPrefix(path, api+"/tags/"):
+		for _, rel := range g.releases {
+			if rel.TagName == strings.TrimPrefix(path, api+"/tags/") {
+				g.writeJSON(w, rel)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case path == api:
+		g.writeJSON(w, g.releases)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *fakeGitHub) serveFile(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := g.files[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func (g *fakeGitHub) writeJSON(w http.ResponseWriter, v interface{}) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		g.t.Error(err)
+	}
+}
+
+// config 使用该替身服务作为 github 更新源
+func (g *fakeGitHub) config(configure func(cfg *Config)) func(cfg *Config) {
+	return func(cfg *Config) {
+		cfg.Source = SOURCE_GITHUB
+		cfg.GitHubRepo = "acme/allinone"
+		cfg.GitHubAPIUrl = g.srv.URL + "/api/v3"
+		cfg.GitHubToken = g.token
+		cfg.AllowUnsignedManifest = true
+		if configure != nil {
+			configure(cfg)
+		}
+	}
+}
+
+// githubAssetName 返回 build.sh 生成的当前平台的附件名称
+func githubAssetName(version string) string {
+	p := CurrentPlatform()
+	return fmt.Sprintf("download_allinone_%s_%s_%s", p.OS, p.Arch, version)
+}
+
+// checksumFile 生成 sha256sum 格式的摘要文件
+func checksumFile(files map[string][]byte) []byte {
+	var b strings.Builder
+	b.WriteString("# SHA256 Checksums\n")
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&b, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	return []byte(b.String())
+}
+
+func TestGitHubSourceChecksumsAndSignatures(t *testing.T) {
+	key := newTestMinisignKey(t)
+	name := githubAssetName("1.2.0")
+	binary := []byte("allinone 1.2.0")
+
+	g := newFakeGitHub(t)
+	g.token = "ghp_test"
+	g.addRelease("v1.2.0", false, false, map[string][]byte{
+		name:                           binary,
+		name + GITHUB_SIGNATURE_SUFFIX: []byte(key.sign(binary, name, true)),
+		"SHA256SUMS.txt":               checksumFile(map[string][]byte{name: binary}),
+		"download_allinone_1.2.0.zip":  []byte("zip"),
+	})
+	u := newTestUpdater(t, g.config(func(cfg *Config) {
+		cfg.ArtifactPublicKeys = []string{key.publicKey()}
+		cfg.AllowUnsignedArtifacts = false
+	}))
+
+	info, err := u.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.2.0" || info.Artifact.SHA256 == "" || info.Artifact.Signature == "" {
+		t.Fatalf("应从 SHA256SUMS.txt 和 .minisig 附件取得摘要和签名，实际为 %+v", info.Artifact)
+	}
+	src, err := u.source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := u.fetchArtifact(src, info.Artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	if data, _ := os.ReadFile(file); string(data) != string(binary) {
+		t.Fatalf("下载的内容不一致: %q", data)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.leaked) > 0 {
+		t.Fatalf("令牌不应发送给接口以外的地址: %v", g.leaked)
+	}
+}
+
+func TestGitHubSourceRejectsConflictingChecksums(t *testing.T) {
+	name := githubAssetName("1.2.0")
+	g := newFakeGitHub(t)
+	g.addRelease("v1.2.0", false, true, map[string][]byte{
+		name:             []byte("allinone 1.2.0"),
+		"SHA256SUMS.txt": checksumFile(map[string][]byte{name: []byte("其他内容")}),
+	})
+	u := newTestUpdater(t, g.config(nil))
+
+	if _, err := u.Check(); !errors.Is(err, ErrArtifactMismatch) {
+		t.Fatalf("digest 与 SHA256SUMS.txt 不一致时应拒绝，实际错误: %v", err)
+	}
+}
+
+func TestGitHubSourceSelectsReleaseByChannel(t *testing.T) {
+	g := newFakeGitHub(t)
+	for _, r := range []struct {
+		tag        string
+		prerelease bool
+	}{
+		{"v1.2.0", false},
+		{"v1.3.0-rc.1", true},
+		{"v1.4.0-nightly.20261017", true},
+	} {
+		version := strings.TrimPrefix(r.tag, "v")
+		g.addRelease(r.tag, r.prerelease, true, map[string][]byte{githubAssetName(version): []byte(version)})
+	}
+
+	cases := []struct {
+		channel    string
+		prerelease bool
+		want       string
+	}{
+		{CHANNEL_STABLE, false, "1.2.0"},
+		{CHANNEL_BETA, false, "1.3.0-rc.1"},
+		{CHANNEL_NIGHTLY, false, "1.4.0-nightly.20261017"},
+		{CHANNEL_STABLE, true, "1.4.0-nightly.20261017"},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s/prerelease=%v", c.channel, c.prerelease), func(t *testing.T) {
+			u := newTestUpdater(t, g.config(func(cfg *Config) {
+				cfg.Channel = c.channel
+				cfg.GitHubPrerelease = c.prerelease
+			}))
+			info, err := u.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Version != c.want {
+				t.Fatalf("应选择 %s，实际为 %s", c.want, info.Version)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SecretKeyEntry 带密钥 ID 和有效期的共享密钥，用于在不同时替换所有设备配置的情况下轮换密钥
+type SecretKeyEntry struct {
+	ID        string     `json:"id" yaml:"id" toml:"id"`
+	Key       string     `json:"key,omitempty" yaml:"key,omitempty" toml:"key,omitempty"`
+	KeyFile   string     `json:"key_file,omitempty" yaml:"key_file,omitempty" toml:"key_file,omitempty"`
+	KeyEnv    string     `json:"key_env,omitempty" yaml:"key_env,omitempty" toml:"key_env,omitempty"`
+	Encoding  string     `json:"encoding,omitempty" yaml:"encoding,omitempty" toml:"encoding,omitempty"`
+	NotBefore *time.Time `json:"not_before,omitempty" yaml:"not_before,omitempty" toml:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty" yaml:"not_after,omitempty" toml:"not_after,omitempty"`
+}
+
+// PublicKeyEntry 带密钥 ID 和有效期的 Ed25519 公钥（base64），ID 为空时使用 KeyID 计算
+type PublicKeyEntry struct {
+	ID        string     `json:"id,omitempty" yaml:"id,omitempty" toml:"id,omitempty"`
+	PublicKey string     `json:"public_key" yaml:"public_key" toml:"public_key"`
+	NotBefore *time.Time `json:"not_before,omitempty" yaml:"not_before,omitempty" toml:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty" yaml:"not_after,omitempty" toml:"not_after,omitempty"`
+}
+
+// KeyRotation 服务器随版本信息下发的密钥轮换记录，签名覆盖 Record 的原始字节，
+// 必须由当前有效的版本信息公钥签名
+type KeyRotation struct {
+	Record     json.RawMessage     `json:"record"`
+	Signatures []ManifestSignature `json:"signatures"`
+}
+
+// KeyRotationRecord 密钥轮换记录的内容，只能新增密钥，不能修改或删除已有的密钥。
+// 共享密钥只支持内联的 key 和 encoding
+type KeyRotationRecord struct {
+	SecretKeys   []SecretKeyEntry `json:"secret_keys,omitempty"`
+	ManifestKeys []PublicKeyEntry `json:"manifest_keys,omitempty"`
+}
+
+// secretKey 解析后的共享密钥，id 为空表示 secret_key 配置的旧密钥
+type secretKey struct {
+	id        string
+	key       []byte
+	notBefore *time.Time
+	notAfter  *time.Time
+}
+
+// manifestKey 解析后的版本信息公钥
+type manifestKey struct {
+	id        string
+	key       ed25519.PublicKey
+	notBefore *time.Time
+	notAfter  *time.Time
+}
+
+// validAt 判断 t 是否在有效期内，未设置的边界不做限制
+func validAt(notBefore, notAfter *time.Time, t time.Time) bool {
+	if notBefore != nil && t.Before(*notBefore) {
+		return false
+	}
+	if notAfter != nil && !t.Before(*notAfter) {
+		return false
+	}
+	return true
+}
+
+func (k secretKey) validAt(t time.Time) bool   { return validAt(k.notBefore, k.notAfter, t) }
+func (k manifestKey) validAt(t time.Time) bool { return validAt(k.notBefore, k.notAfter, t) }
+
+// secretKeyRing 解析 secret_key 和 secret_keys 中的全部共享密钥。
+// 设置了 secret_keys 时 secret_key 可以为空
+func (c Config) secretKeyRing() ([]secretKey, error) {
+	var errs []error
+	var keys []secretKey
+
+	legacy := c.legacyKeySource()
+	// 只有加密的版本接口必须配置共享密钥，其他更新源和通过 TUF 元数据获取版本信息时没有配置则不使用密钥
+	if len(c.SecretKeys) == 0 && legacy.empty() && ((c.Source != "" && c.Source != SOURCE_API) || c.TUFMetadataUrl != "") {
+		return nil, nil
+	}
+	if len(c.SecretKeys) == 0 || !legacy.empty() {
+		key, err := legacy.resolve()
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			keys = append(keys, secretKey{key: key})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, e := range c.SecretKeys {
+		prefix := fmt.Sprintf("secret_keys[%d].", i)
+		key, err := e.resolve(prefix)
+		if err == nil {
+			err = checkKeyEntry(prefix, e.ID, e.NotBefore, e.NotAfter, seen)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, secretKey{id: e.ID, key: key, notBefore: e.NotBefore, notAfter: e.NotAfter})
+	}
+	return keys, errors.Join(errs...)
+}
+
+// manifestKeyRing 解析 manifest_public_keys 和 manifest_keys 中的全部版本信息公钥
+func (c Config) manifestKeyRing() ([]manifestKey, error) {
+	var errs []error
+	var keys []manifestKey
+
+	legacy, err := parsePublicKeys(c.ManifestPublicKeys)
+	if err != nil {
+		errs = append(errs, &ConfigError{Field: "manifest_public_keys", Msg: err.Error()})
+	}
+	for _, key := range legacy {
+		keys = append(keys, manifestKey{id: KeyID(key), key: key})
+	}
+
+	seen := make(map[string]bool)
+	for i, e := range c.ManifestKeys {
+		prefix := fmt.Sprintf("manifest_keys[%d].", i)
+		key, err := e.parse(prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := checkKeyEntry(prefix, key.id, e.NotBefore, e.NotAfter, seen); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, errors.Join(errs...)
+}
+
+// resolve 读取并解码密钥，prefix 为错误信息中配置项名称的前缀
+func (e SecretKeyEntry) resolve(prefix string) ([]byte, error) {
+	return keySource{
+		fields:   [4]string{prefix + "key", prefix + "key_file", prefix + "key_env", prefix + "encoding"},
+		key:      e.Key,
+		file:     e.KeyFile,
+		env:      e.KeyEnv,
+		encoding: e.Encoding,
+	}.resolve()
+}
+
+// parse 解析公钥，prefix 为错误信息中配置项名称的前缀
+func (e PublicKeyEntry) parse(prefix string) (manifestKey, error) {
+	keys, err := parsePublicKeys([]string{e.PublicKey})
+	if err != nil {
+		return manifestKey{}, &ConfigError{Field: prefix + "public_key", Msg: err.Error()}
+	}
+	id := e.ID
+	if id == "" {
+		id = KeyID(keys[0])
+	}
+	return manifestKey{id: id, key: keys[0], notBefore: e.NotBefore, notAfter: e.NotAfter}, nil
+}
+
+// checkKeyEntry 检查密钥 ID 不为空且不重复，有效期的结束时间晚于开始时间
+func checkKeyEntry(prefix, id string, notBefore, notAfter *time.Time, seen map[string]bool) error {
+	if id == "" {
+		return &ConfigError{Field: prefix + "id", Msg: "不能为空"}
+	}
+	if seen[id] {
+		return &ConfigError{Field: prefix + "id", Msg: fmt.Sprintf("%q 重复", id)}
+	}
+	seen[id] = true
+	if notBefore != nil && notAfter != nil && !notAfter.After(*notBefore) {
+		return &ConfigError{Field: prefix + "not_after", Msg: "必须晚于 not_before"}
+	}
+	return nil
+}
+
+// loadKeyRings 合并配置中的密钥和本地保存的轮换密钥，配置中已有的密钥 ID 优先
+func (u *Updater) loadKeyRings(cfg Config) ([]secretKey, []manifestKey, error) {
+	secrets, err := cfg.secretKeyRing()
+	if err != nil {
+		return nil, nil, err
+	}
+	manifests, err := cfg.manifestKeyRing()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rec, err := u.readKeyStore(cfg)
+	if err != nil {
+		u.logf("读取轮换密钥失败: %v", err)
+		return secrets, manifests, nil
+	}
+	secrets, manifests, _ = mergeRotation(secrets, manifests, rec)
+	return secrets, manifests, nil
+}
+
+// mergeRotation 把轮换记录中尚未存在的密钥加入密钥环，返回新增的密钥 ID
+func mergeRotation(secrets []secretKey, manifests []manifestKey, rec KeyRotationRecord) ([]secretKey, []manifestKey, []string) {
+	var added []string
+	known := make(map[string]bool)
+	for _, k := range secrets {
+		known["secret:"+k.id] = true
+	}
+	for _, k := range manifests {
+		known["manifest:"+k.id] = true
+	}
+
+	for i, e := range rec.SecretKeys {
+		if e.ID == "" || known["secret:"+e.ID] || e.KeyFile != "" || e.KeyEnv != "" {
+			continue
+		}
+		key, err := e.resolve(fmt.Sprintf("secret_keys[%d].", i))
+		if err != nil {
+			continue
+		}
+		known["secret:"+e.ID] = true
+		secrets = append(secrets, secretKey{id: e.ID, key: key, notBefore: e.NotBefore, notAfter: e.NotAfter})
+		added = append(added, e.ID)
+	}
+	for i, e := range rec.ManifestKeys {
+		key, err := e.parse(fmt.Sprintf("manifest_keys[%d].", i))
+		if err != nil || known["manifest:"+key.id] {
+			continue
+		}
+		known["manifest:"+key.id] = true
+		manifests = append(manifests, key)
+		added = append(added, key.id)
+	}
+	return secrets, manifests, added
+}
+
+// signingKey 返回用于签名请求的共享密钥：当前有效的密钥中开始时间最晚的一个
+func (u *Updater) signingKey() (secretKey, error) {
+	now := u.now()
+	var best *secretKey
+	for i := range u.keys {
+		k := &u.keys[i]
+		if !k.validAt(now) {
+			continue
+		}
+		if best == nil || (k.notBefore != nil && (best.notBefore == nil || k.notBefore.After(*best.notBefore))) {
+			best = k
+		}
+	}
+	if best == nil {
+		return secretKey{}, fmt.Errorf("没有当前有效的共享密钥")
+	}
+	return *best, nil
+}
+
+// decryptionKeys 返回解密版本信息时依次尝试的密钥。响应指定了密钥 ID 时只使用该密钥，
+// 否则签名密钥优先，其次是其他当前有效的密钥
+func (u *Updater) decryptionKeys(keyID string) [][]byte {
+	now := u.trustedNow()
+	if keyID != "" {
+		for _, k := range u.keys {
+			if k.id == keyID && k.validAt(now) {
+				return [][]byte{k.key}
+			}
+		}
+	}
+
+	var keys [][]byte
+	signing, err := u.signingKey()
+	if err == nil && signing.validAt(now) {
+		keys = append(keys, signing.key)
+	}
+	for _, k := range u.keys {
+		if k.validAt(now) && (err != nil || k.id != signing.id) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
+// acceptKeyRotation 校验并保存服务器下发的密钥轮换记录
+func (u *Updater) acceptKeyRotation(r *KeyRotation) error {
+	if _, err := u.verifySignatures(r.Record, r.Signatures); err != nil {
+		return err
+	}
+	var rec KeyRotationRecord
+	if err := json.Unmarshal(r.Record, &rec); err != nil {
+		return fmt.Errorf("解析密钥轮换记录失败: %v", err)
+	}
+
+	secrets, manifests, added := mergeRotation(u.keys, u.manifestKeys, rec)
+	if len(added) == 0 {
+		return nil
+	}
+
+	stored, err := u.readKeyStore(u.cfg)
+	if err != nil {
+		return err
+	}
+	// 只保存新增的密钥
+	isAdded := make(map[string]bool)
+	for _, id := range added {
+		isAdded[id] = true
+	}
+	for _, e := range rec.SecretKeys {
+		if isAdded[e.ID] {
+			stored.SecretKeys = append(stored.SecretKeys, e)
+		}
+	}
+	for _, e := range rec.ManifestKeys {
+		if key, err := e.parse(""); err == nil && isAdded[key.id] {
+			stored.ManifestKeys = append(stored.ManifestKeys, e)
+		}
+	}
+	if err := u.writeKeyStore(stored); err != nil {
+		return err
+	}
+
+	u.cfgMu.Lock()
+	u.keys = secrets
+	u.manifestKeys = manifests
+	u.cfgMu.Unlock()
+	u.logf("已接受密钥轮换记录，新增密钥: %v", added)
+	return nil
+}
+
+// readKeyStore 读取本地保存的轮换密钥，文件不存在时返回空记录
+func (u *Updater) readKeyStore(cfg Config) (KeyRotationRecord, error) {
+	var rec KeyRotationRecord
+	path := u.path(cfg.KeyStoreFile)
+	data, err := readKeyFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rec, nil
+	}
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("解析轮换密钥文件 %s 失败: %v", path, err)
+	}
+	return rec, nil
+}
+
+// writeKeyStore 保存轮换密钥，丢弃已经过期的密钥
+func (u *Updater) writeKeyStore(rec KeyRotationRecord) error {
+	now := u.now()
+	var kept KeyRotationRecord
+	for _, e := range rec.SecretKeys {
+		if e.NotAfter == nil || now.Before(*e.NotAfter) {
+			kept.SecretKeys = append(kept.SecretKeys, e)
+		}
+	}
+	for _, e := range rec.ManifestKeys {
+		if e.NotAfter == nil || now.Before(*e.NotAfter) {
+			kept.ManifestKeys = append(kept.ManifestKeys, e)
+		}
+	}
+
+	data, err := json.MarshalIndent(kept, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := u.path(u.cfg.KeyStoreFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("保存轮换密钥失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("保存轮换密钥失败: %v", err)
+	}
+	return nil
+}
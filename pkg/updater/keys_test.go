@@ -0,0 +1,103 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcceptKeyRotation(t *testing.T) {
+	oldPub, oldPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPub, newPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, attacker, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := json.Marshal(KeyRotationRecord{
+		SecretKeys:   []SecretKeyEntry{{ID: "k2", Key: "fedcba9876543210"}},
+		ManifestKeys: []PublicKeyEntry{{PublicKey: base64.StdEncoding.EncodeToString(newPub)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := func(priv ed25519.PrivateKey) *KeyRotation {
+		return &KeyRotation{Record: record, Signatures: SignManifest(priv, record).Signatures}
+	}
+	forged := signed(attacker)
+	forged.Signatures[0].KeyID = KeyID(oldPub)
+	tampered := signed(oldPriv)
+	tampered.Record = json.RawMessage(`{"secret_keys":[{"id":"k2","key":"attacker-key-0000"}]}`)
+
+	cases := []struct {
+		name     string
+		rotation *KeyRotation
+		ok       bool
+	}{
+		{"已有公钥签名", signed(oldPriv), true},
+		{"未签名", &KeyRotation{Record: record}, false},
+		{"新公钥自签名", signed(newPriv), false},
+		{"冒用已有公钥 ID", forged, false},
+		{"记录被修改", tampered, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := DefaultConfig()
+			cfg.ApiUrl = "https://update.example.com/api/version"
+			cfg.SecretKeys = []SecretKeyEntry{{ID: "k1", Key: testSecretKey}}
+			cfg.ManifestPublicKeys = []string{base64.StdEncoding.EncodeToString(oldPub)}
+			cfg.AllowUnsignedArtifacts = true
+			open := func() *Updater {
+				u, err := New(cfg, WithWorkDir(dir), WithLogger(NewLogManager(filepath.Join(dir, "logs"))))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return u
+			}
+			u := open()
+
+			err := u.acceptKeyRotation(c.rotation)
+			if !c.ok {
+				if err == nil {
+					t.Fatal("应拒绝没有有效签名的密钥轮换记录")
+				}
+				if len(u.keys) != 1 || len(u.manifestKeys) != 1 {
+					t.Fatalf("拒绝后密钥环不应变化: %d 个共享密钥，%d 个公钥", len(u.keys), len(u.manifestKeys))
+				}
+				if _, err := os.Stat(u.path(cfg.KeyStoreFile)); !os.IsNotExist(err) {
+					t.Fatalf("拒绝后不应保存轮换密钥: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 重新启动后从本地保存的记录加载新密钥，新公钥签名的版本信息可以通过校验
+			u = open()
+			var ids []string
+			for _, k := range u.keys {
+				ids = append(ids, k.id)
+			}
+			if len(ids) != 2 || ids[1] != "k2" {
+				t.Fatalf("应加载轮换下发的共享密钥 k2，实际为 %v", ids)
+			}
+			manifest := []byte(`{"version":"1.2.0"}`)
+			data, _ := json.Marshal(SignManifest(newPriv, manifest))
+			if _, err := u.verifyManifest(data); err != nil {
+				t.Fatalf("轮换后新公钥签名的版本信息应通过校验: %v", err)
+			}
+		})
+	}
+}
@@ -7,53 +7,72 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// LogManager 按天轮转的日志管理器，dir 为空时只输出到控制台
 type LogManager struct {
+	mu            sync.Mutex
+	dir           string
 	currentDay    string
 	currentLogger *log.Logger
 	Logfile       *os.File
+	clockOffset   time.Duration
 }
 
-// 全局变量
-var logManager *LogManager
+// NewLogManager 创建日志管理器，日志目录在首次写入时创建
+func NewLogManager(dir string) *LogManager {
+	return &LogManager{dir: dir}
+}
 
-// 初始化日志管理器
-func InitLogger() error {
-	logManager = &LogManager{}
-	if err := os.MkdirAll(LOG_DIR, 0755); err != nil {
-		return fmt.Errorf("创建日志目录失败: %v", err)
-	}
+// Init 立即创建日志目录并打开当天的日志文件
+func (lm *LogManager) Init() error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
 
-	if err := logManager.rotateLog(); err != nil {
+	if err := lm.rotateLog(); err != nil {
 		return fmt.Errorf("初始化日志失败: %v", err)
 	}
+	return nil
+}
 
-	// 清理旧日志
-	if err := cleanOldLogs(); err != nil {
-		return fmt.Errorf("清理旧日志失败: %v", err)
-	}
+// SetClockOffset 设置日志时间相对本地时间的偏移，用于本地时钟不准确的设备
+func (lm *LogManager) SetClockOffset(d time.Duration) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.clockOffset = d
+}
 
-	return nil
+// now 返回修正后的当前时间，调用方需持有锁
+func (lm *LogManager) now() time.Time {
+	return time.Now().Add(lm.clockOffset)
 }
 
 // 日志轮转
 func (lm *LogManager) rotateLog() error {
-	currentDay := time.Now().Format("2006-01-02")
+	if lm.dir == "" {
+		return nil
+	}
+
+	currentDay := lm.now().Format("2006-01-02")
 
 	// 如果日期没变且文件已打开，直接返回
 	if currentDay == lm.currentDay && lm.Logfile != nil {
 		return nil
 	}
 
+	if err := os.MkdirAll(lm.dir, 0755); err != nil {
+		return fmt.Errorf("创建日志目录失败: %v", err)
+	}
+
 	// 关闭旧的日志文件
 	if lm.Logfile != nil {
 		lm.Logfile.Close()
 	}
 
 	// 打开新的日志文件
-	logPath := filepath.Join(LOG_DIR, fmt.Sprintf("app_%s.log", currentDay))
+	logPath := filepath.Join(lm.dir, fmt.Sprintf("app_%s.log", currentDay))
 	Logfile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return err
@@ -61,14 +80,20 @@ func (lm *LogManager) rotateLog() error {
 
 	lm.currentDay = currentDay
 	lm.Logfile = Logfile
-	lm.currentLogger = log.New(Logfile, "", log.Ldate|log.Ltime|log.Lshortfile)
+	// 时间由 output 写入前缀，以便使用修正后的时间
+	lm.currentLogger = log.New(Logfile, "", log.Lshortfile)
+
+	// 清理旧日志
+	if err := lm.cleanOldLogs(); err != nil {
+		return fmt.Errorf("清理旧日志失败: %v", err)
+	}
 
 	return nil
 }
 
 // 清理旧日志
-func cleanOldLogs() error {
-	files, err := os.ReadDir(LOG_DIR)
+func (lm *LogManager) cleanOldLogs() error {
+	files, err := os.ReadDir(lm.dir)
 	if err != nil {
 		return err
 	}
@@ -88,7 +113,7 @@ func cleanOldLogs() error {
 	// 删除7天前的日志
 	if len(Logfiles) > 7 {
 		for _, file := range Logfiles[7:] {
-			if err := os.Remove(filepath.Join(LOG_DIR, file)); err != nil {
+			if err := os.Remove(filepath.Join(lm.dir, file)); err != nil {
 				return err
 			}
 		}
@@ -97,30 +122,56 @@ func cleanOldLogs() error {
 	return nil
 }
 
-// 写日志的辅助函数
-func Logf(format string, v ...interface{}) {
+// Close 关闭当前日志文件
+func (lm *LogManager) Close() error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.Logfile == nil {
+		return nil
+	}
+	err := lm.Logfile.Close()
+	lm.Logfile = nil
+	lm.currentDay = ""
+	return err
+}
+
+// Logf 写入一条日志
+func (lm *LogManager) Logf(format string, v ...interface{}) {
+	lm.output(3, fmt.Sprintf(format, v...))
+}
+
+// output 写入日志文件并同时输出到控制台，calldepth 用于定位调用方源码位置
+func (lm *LogManager) output(calldepth int, msg string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
 	// 确保日志轮转正常
-	if err := logManager.rotateLog(); err != nil {
+	if err := lm.rotateLog(); err != nil {
 		log.Printf("轮转日志失败: %v", err)
 		return
 	}
 
-	// 格式化消息
-	msg := fmt.Sprintf(format, v...)
+	timestamp := lm.now().Format("2006/01/02 15:04:05")
 
 	// 写入日志文件
-	logManager.currentLogger.Output(2, msg)
+	if lm.currentLogger != nil {
+		lm.currentLogger.SetPrefix(timestamp + " ")
+		lm.currentLogger.Output(calldepth, msg)
+	}
 
 	// 同时输出到控制台
 	fmt.Printf("%s %s\n",
-		time.Now().Format("2006/01/02 15:04:05"),
+		timestamp,
 		msg,
 	)
 }
 
 // LogStartupInfo 记录启动信息
-func LogStartupInfo() {
-	currentTime := time.Now()
-	Logf("系统当前时间: %v", currentTime.Format("2006-01-02 15:04:05"))
-	Logf("Unix时间戳: %d", currentTime.Unix())
+func (lm *LogManager) LogStartupInfo() {
+	lm.mu.Lock()
+	currentTime := lm.now()
+	lm.mu.Unlock()
+	lm.Logf("系统当前时间: %v", currentTime.Format("2006-01-02 15:04:05"))
+	lm.Logf("Unix时间戳: %d", currentTime.Unix())
 }
@@ -0,0 +1,116 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// SignedManifest 带有分离 Ed25519 签名的版本信息，签名覆盖 Manifest 的原始字节
+type SignedManifest struct {
+	Manifest   json.RawMessage     `json:"manifest"`
+	Signatures []ManifestSignature `json:"signatures"`
+	// KeyRotation 可选的密钥轮换记录，用于提前下发下一个密钥
+	KeyRotation *KeyRotation `json:"key_rotation,omitempty"`
+}
+
+// ManifestSignature 版本信息签名，KeyID 为空时依次尝试所有当前有效的公钥
+type ManifestSignature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// KeyID 返回公钥的标识：SHA-256 摘要前 8 字节的 hex
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignManifest 使用私钥签名版本信息，供发布工具生成 SignedManifest
+func SignManifest(priv ed25519.PrivateKey, manifest []byte) SignedManifest {
+	pub := priv.Public().(ed25519.PublicKey)
+	return SignedManifest{
+		Manifest: json.RawMessage(manifest),
+		Signatures: []ManifestSignature{{
+			KeyID: KeyID(pub),
+			Sig:   base64.StdEncoding.EncodeToString(ed25519.Sign(priv, manifest)),
+		}},
+	}
+}
+
+// parsePublicKeys 解析 base64 编码的 Ed25519 公钥列表
+func parsePublicKeys(encoded []string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(encoded))
+	for _, s := range encoded {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("公钥 %q 不是有效的 base64 编码: %v", s, err)
+		}
+		if len(data) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("公钥 %q 的长度必须为 %d 字节，当前为 %d 字节", s, ed25519.PublicKeySize, len(data))
+		}
+		keys = append(keys, ed25519.PublicKey(data))
+	}
+	return keys, nil
+}
+
+// verifyManifest 校验解密后的版本信息，返回其中的版本信息原始字节。
+// 配置了版本信息公钥时必须是带有效签名的 SignedManifest，没有配置时只有设置了 allow_unsigned_manifest 才接受未签名的版本信息
+func (u *Updater) verifyManifest(data []byte) ([]byte, error) {
+	var signed SignedManifest
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("解析版本信息失败: %v", err)
+	}
+
+	if len(u.manifestKeys) == 0 {
+		if !u.cfg.AllowUnsignedManifest {
+			return nil, fmt.Errorf("没有配置版本信息公钥，拒绝未签名的版本信息")
+		}
+		if signed.KeyRotation != nil {
+			u.logf("没有配置版本信息公钥，忽略密钥轮换记录")
+		}
+		if signed.Manifest != nil {
+			return signed.Manifest, nil
+		}
+		return data, nil
+	}
+
+	if signed.Manifest == nil {
+		return nil, fmt.Errorf("版本信息没有签名")
+	}
+	id, err := u.verifySignatures(signed.Manifest, signed.Signatures)
+	if err != nil {
+		return nil, fmt.Errorf("版本信息%v", err)
+	}
+	u.logf("版本信息签名校验通过，公钥: %s", id)
+
+	if signed.KeyRotation != nil {
+		if err := u.acceptKeyRotation(signed.KeyRotation); err != nil {
+			u.logf("密钥轮换记录无效，已忽略: %v", err)
+		}
+	}
+	return signed.Manifest, nil
+}
+
+// verifySignatures 使用当前有效的版本信息公钥校验签名，返回签名通过的公钥 ID
+func (u *Updater) verifySignatures(data []byte, sigs []ManifestSignature) (string, error) {
+	now := u.trustedNow()
+	for _, s := range sigs {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		for _, key := range u.manifestKeys {
+			if (s.KeyID != "" && s.KeyID != key.id) || !key.validAt(now) {
+				continue
+			}
+			if ed25519.Verify(key.key, data, sig) {
+				return key.id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("签名校验失败，没有与当前有效公钥匹配的有效签名")
+}
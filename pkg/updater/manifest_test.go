@@ -0,0 +1,84 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestVerifyManifestRequiresSignatureOrOptIn(t *testing.T) {
+	manifest := []byte(`{"version":"1.2.0"}`)
+
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.Source = SOURCE_STATIC
+		cfg.SourceURL = "https://example.com/manifest.json"
+		cfg.AllowUnsignedManifest = true
+	})
+	if got, err := u.verifyManifest(manifest); err != nil || string(got) != string(manifest) {
+		t.Fatalf("设置 allow_unsigned_manifest 时应接受未签名的版本信息: %s, %v", got, err)
+	}
+
+	u.cfg.AllowUnsignedManifest = false
+	if _, err := u.verifyManifest(manifest); err == nil {
+		t.Fatal("没有公钥也没有设置 allow_unsigned_manifest 时应拒绝未签名的版本信息")
+	}
+	if fields := configErrorFields(u.cfg.Validate()); !fields["manifest_public_keys"] {
+		t.Fatalf("没有公钥也没有设置 allow_unsigned_manifest 时配置校验应失败，实际出错的配置项: %v", fields)
+	}
+}
+
+func TestVerifyManifestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.Source = SOURCE_STATIC
+		cfg.SourceURL = "https://example.com/manifest.json"
+		cfg.ManifestPublicKeys = []string{base64.StdEncoding.EncodeToString(pub)}
+	})
+
+	manifest := []byte(`{"version":"1.2.0"}`)
+	encode := func(s SignedManifest) []byte {
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tampered := SignManifest(priv, manifest)
+	tampered.Manifest = json.RawMessage(`{"version":"9.9.9"}`)
+	wrongKeyID := SignManifest(other, manifest)
+	wrongKeyID.Signatures[0].KeyID = KeyID(pub)
+
+	cases := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"有效签名", encode(SignManifest(priv, manifest)), true},
+		{"未签名", manifest, false},
+		{"内容被修改", encode(tampered), false},
+		{"其他私钥签名", encode(SignManifest(other, manifest)), false},
+		{"冒用公钥 ID", encode(wrongKeyID), false},
+		{"没有签名", encode(SignedManifest{Manifest: manifest}), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := u.verifyManifest(c.data)
+			if c.ok {
+				if err != nil || string(got) != string(manifest) {
+					t.Fatalf("应接受签名有效的版本信息: %s, %v", got, err)
+				}
+			} else if err == nil {
+				t.Fatal("应拒绝签名无效的版本信息")
+			}
+		})
+	}
+}
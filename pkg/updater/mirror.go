@@ -0,0 +1,178 @@
+package updater
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MIRROR_SCORE_ALPHA 更新镜像成功率和延迟的指数加权系数，越大越看重最近的下载结果
+const MIRROR_SCORE_ALPHA = 0.3
+
+// MirrorStats 某个下载线路（代理前缀加镜像主机）的历史下载情况，保存在状态文件中
+type MirrorStats struct {
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+	// SuccessRate 成功率的指数加权平均
+	SuccessRate float64 `json:"success_rate"`
+	// Latency 收到响应头所用时间的指数加权平均
+	Latency Duration `json:"latency"`
+	// Throughput 最近一次成功下载的速度（字节/秒）
+	Throughput float64   `json:"throughput,omitempty"`
+	LastUsed   time.Time `json:"last_used"`
+}
+
+// score 线路得分，成功率越高、延迟越低得分越高。没有记录的线路按 50% 成功率计算，
+// 使新加入的镜像有机会被尝试
+func (s *MirrorStats) score() float64 {
+	if s == nil {
+		return 0.5
+	}
+	return s.SuccessRate / (1 + time.Duration(s.Latency).Seconds())
+}
+
+// record 记录一次下载结果
+func (s *MirrorStats) record(ok bool, latency time.Duration, throughput float64, now time.Time) {
+	first := s.Successes+s.Failures == 0
+	result := 0.0
+	if ok {
+		result = 1
+		s.Successes++
+		s.Throughput = throughput
+	} else {
+		s.Failures++
+	}
+	if first {
+		s.SuccessRate = result
+	} else {
+		s.SuccessRate += MIRROR_SCORE_ALPHA * (result - s.SuccessRate)
+	}
+	if latency > 0 {
+		if s.Latency == 0 {
+			s.Latency = Duration(latency)
+		} else {
+			s.Latency += Duration(MIRROR_SCORE_ALPHA * float64(Duration(latency)-s.Latency))
+		}
+	}
+	s.LastUsed = now
+}
+
+// downloadCandidate 一个可尝试的下载地址
+type downloadCandidate struct {
+	url string
+	// key 统计线路得分使用的键：代理前缀加镜像的 scheme://host，本地文件为所在目录
+	key string
+}
+
+// proxyPrefixes 返回用于 mirror 的代理前缀，去掉重复项。proxy_prefix 是 GitHub 加速代理，
+// 只用于 GitHub 的地址，避免把内网或私有镜像的地址发给第三方；proxy_prefixes 由运维显式配置，用于所有 http(s) 地址
+func (c Config) proxyPrefixes(mirror string) []string {
+	if !isHTTPURL(mirror) {
+		return nil
+	}
+	var prefixes []string
+	seen := map[string]bool{}
+	candidates := c.ProxyPrefixes
+	if isGitHubURL(mirror) {
+		candidates = append([]string{c.ProxyPrefix}, candidates...)
+	}
+	for _, p := range candidates {
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		prefixes = append(prefixes, p)
+	}
+	return prefixes
+}
+
+// isGitHubURL 判断地址是否指向 GitHub 的主机，包括 Release 附件实际所在的 *.githubusercontent.com
+func isGitHubURL(s string) bool {
+	parsed, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return host == "github.com" || strings.HasSuffix(host, ".github.com") || strings.HasSuffix(host, ".githubusercontent.com")
+}
+
+// downloadCandidates 列出制品所有镜像的直连和经过代理前缀的下载地址，按线路得分从高到低排序，
+// 得分相同时保持制品中镜像的顺序，且直连优先于代理
+func (u *Updater) downloadCandidates(artifact Artifact) []downloadCandidate {
+	var candidates []downloadCandidate
+	seen := map[string]bool{}
+	add := func(prefix, mirror string) {
+		if seen[prefix+mirror] {
+			return
+		}
+		seen[prefix+mirror] = true
+		// 本地文件按所在目录统计，避免每个版本的文件都单独记录
+		host := "file://" + filepath.Dir(strings.TrimPrefix(mirror, "file://"))
+		if parsed, err := url.Parse(mirror); err == nil && parsed.Host != "" {
+			host = parsed.Scheme + "://" + parsed.Host
+		}
+		candidates = append(candidates, downloadCandidate{url: prefix + mirror, key: prefix + host})
+	}
+	for _, mirror := range append([]string{artifact.URL}, artifact.Mirrors...) {
+		if mirror == "" {
+			continue
+		}
+		add("", mirror)
+		// 代理前缀只用于 http(s) 地址，本地目录中的制品直接读取
+		for _, prefix := range u.cfg.proxyPrefixes(mirror) {
+			add(prefix, mirror)
+		}
+	}
+
+	u.stateMu.Lock()
+	stats := u.state.Mirrors
+	scores := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c.key] = stats[c.key].score()
+	}
+	u.stateMu.Unlock()
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i].key] > scores[candidates[j].key]
+	})
+	return candidates
+}
+
+// recordDownload 保存下载线路的结果
+func (u *Updater) recordDownload(c downloadCandidate, result downloadResult, downloadErr error) {
+	ok := downloadErr == nil
+	throughput := result.throughput()
+	now := u.now()
+	if err := u.updateState(func(st *State) {
+		if st.Mirrors == nil {
+			st.Mirrors = map[string]*MirrorStats{}
+		}
+		s := st.Mirrors[c.key]
+		if s == nil {
+			s = &MirrorStats{}
+			st.Mirrors[c.key] = s
+		}
+		s.record(ok, result.latency, throughput, now)
+	}); err != nil {
+		u.logf("保存下载线路统计失败: %v", err)
+	}
+}
+
+// throughput 下载速度（字节/秒）
+func (r downloadResult) throughput() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.size) / r.elapsed.Seconds()
+}
+
+// formatThroughput 将下载速度格式化为 KB/s 或 MB/s
+func formatThroughput(bytesPerSecond float64) string {
+	if bytesPerSecond >= 1<<20 {
+		return fmt.Sprintf("%.1f MB/s", bytesPerSecond/(1<<20))
+	}
+	return fmt.Sprintf("%.1f KB/s", bytesPerSecond/(1<<10))
+}
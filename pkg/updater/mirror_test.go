@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDownloadCandidates(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ProxyPrefix = "https://ghproxy.example.com/"
+	cfg.ProxyPrefixes = []string{"https://proxy.example.com/"}
+	u := &Updater{cfg: cfg}
+
+	artifact := Artifact{
+		URL:     "https://github.com/example/allinone/releases/download/v1.2.0/allinone",
+		Mirrors: []string{"https://mirror.internal/allinone", "/mnt/usb/allinone"},
+	}
+	var got []string
+	for _, c := range u.downloadCandidates(artifact) {
+		got = append(got, c.url)
+	}
+	want := []string{
+		"https://github.com/example/allinone/releases/download/v1.2.0/allinone",
+		"https://ghproxy.example.com/https://github.com/example/allinone/releases/download/v1.2.0/allinone",
+		"https://proxy.example.com/https://github.com/example/allinone/releases/download/v1.2.0/allinone",
+		"https://mirror.internal/allinone",
+		"https://proxy.example.com/https://mirror.internal/allinone",
+		"/mnt/usb/allinone",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("下载地址应为\n%q\n实际为\n%q", want, got)
+	}
+}
+
+func TestDownloadCandidatesPreferHigherScore(t *testing.T) {
+	cfg := DefaultConfig()
+	u := &Updater{cfg: cfg}
+	u.state.Mirrors = map[string]*MirrorStats{
+		"https://github.com":                   {Failures: 3, SuccessRate: 0},
+		cfg.ProxyPrefix + "https://github.com": {Successes: 3, SuccessRate: 1},
+	}
+
+	candidates := u.downloadCandidates(Artifact{URL: "https://github.com/example/allinone/releases/download/v1.2.0/allinone"})
+	if len(candidates) != 2 || candidates[0].key != cfg.ProxyPrefix+"https://github.com" {
+		t.Fatalf("应先尝试得分更高的代理线路，实际为 %+v", candidates)
+	}
+}
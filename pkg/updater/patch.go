@@ -0,0 +1,215 @@
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kr/binarydist"
+)
+
+// Patch 从指定旧版本到该制品的 bsdiff 差分补丁，只适用于单个可执行文件的制品
+type Patch struct {
+	// From 补丁适用的旧版本
+	From string `json:"from"`
+	// FromSHA256 旧版本程序文件的 SHA-256（hex），与本地程序文件一致时才使用补丁
+	FromSHA256 string `json:"from_sha256"`
+	URL        string `json:"url"`
+	// Mirrors 内容相同的其他下载地址
+	Mirrors []string `json:"mirrors,omitempty"`
+	// SHA256 补丁文件的 SHA-256（hex），没有时不使用补丁
+	SHA256 string `json:"sha256"`
+	// Size 补丁文件大小（字节），为 0 时不校验
+	Size int64 `json:"size,omitempty"`
+	// Signature 补丁文件的 minisign 签名，可以省略，生成的文件会按制品的签名校验
+	Signature string `json:"signature,omitempty"`
+}
+
+// artifact 返回下载和校验补丁文件使用的制品
+func (p Patch) artifact() Artifact {
+	return Artifact{URL: p.URL, Mirrors: p.Mirrors, SHA256: p.SHA256, Size: p.Size, Signature: p.Signature, verifiedLater: true}
+}
+
+// fetchPatched 本地程序文件有适用的差分补丁时下载补丁并生成新版本，返回按制品校验通过的临时文件；
+// 没有适用的补丁或任何一步失败时返回空串，由调用方下载完整制品。
+// 补丁只作用于单个可执行文件，压缩包和带有附加文件的版本不使用补丁
+func (u *Updater) fetchPatched(src Source, artifact Artifact, info *VersionInfo) string {
+	if len(artifact.Patches) == 0 {
+		return ""
+	}
+	if format, err := archiveFormat(artifact, ""); err != nil {
+		u.logf("%v，不使用差分补丁", err)
+		return ""
+	} else if format != ARCHIVE_NONE {
+		u.logf("制品为 %s 压缩包，差分补丁只适用于单个可执行文件，下载完整制品", format)
+		return ""
+	}
+	if len(info.Files) > 0 {
+		u.logf("版本带有附加文件，不使用差分补丁，下载完整制品")
+		return ""
+	}
+	if artifact.SHA256 == "" {
+		u.logf("制品没有提供 SHA-256 摘要，不使用差分补丁")
+		return ""
+	}
+
+	localVersion, err := u.readLocalVersion()
+	if err != nil {
+		u.logf("读取本地版本失败: %v，不使用差分补丁", err)
+		return ""
+	}
+	local, err := ParseVersion(localVersion)
+	if err != nil {
+		u.logf("本地版本号无效: %v，不使用差分补丁", err)
+		return ""
+	}
+	base := u.path(u.cfg.LocalFile)
+	digest, err := fileSHA256(base)
+	if err != nil {
+		u.logf("读取本地程序文件失败: %v，下载完整制品", err)
+		return ""
+	}
+
+	patch, ok := u.findPatch(artifact.Patches, local, digest)
+	if !ok {
+		return ""
+	}
+
+	u.logf("下载 %s 的差分补丁", patch.From)
+	patchFile, err := u.fetchArtifact(src, patch.artifact())
+	if err != nil {
+		u.logf("下载差分补丁失败: %v，下载完整制品", err)
+		return ""
+	}
+	defer os.Remove(patchFile)
+
+	file, err := u.applyPatch(base, patchFile, artifact)
+	if err != nil {
+		u.logf("应用差分补丁失败: %v，下载完整制品", err)
+		return ""
+	}
+	u.logf("已通过差分补丁生成新版本")
+	return file
+}
+
+// findPatch 查找适用于本地版本和程序文件的补丁
+func (u *Updater) findPatch(patches []Patch, local SemVer, digest string) (Patch, bool) {
+	for _, p := range patches {
+		from, err := ParseVersion(p.From)
+		if err != nil || from.Compare(local) != 0 {
+			continue
+		}
+		if p.SHA256 == "" {
+			u.logf("%s 的差分补丁没有提供 SHA-256 摘要，跳过", p.From)
+			continue
+		}
+		if !strings.EqualFold(p.FromSHA256, digest) {
+			u.logf("本地程序文件与 %s 的差分补丁不一致，下载完整制品", p.From)
+			continue
+		}
+		return p, true
+	}
+	u.logf("没有适用于本地版本 %s 的差分补丁，下载完整制品", local)
+	return Patch{}, false
+}
+
+// applyPatch 将补丁应用到 base，生成的文件必须与制品的摘要、大小和签名一致。
+// 成功时返回临时文件，由调用方安装后删除
+func (u *Updater) applyPatch(base, patchFile string, artifact Artifact) (string, error) {
+	keys, err := parseMinisignPublicKeys(u.cfg.ArtifactPublicKeys)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := newArtifactVerifier(artifact, keys)
+	if err != nil {
+		return "", err
+	}
+
+	old, err := os.Open(base)
+	if err != nil {
+		return "", err
+	}
+	defer old.Close()
+	p, err := os.Open(patchFile)
+	if err != nil {
+		return "", err
+	}
+	defer p.Close()
+
+	var patched bytes.Buffer
+	if err := binarydist.Patch(old, &patched, p); err != nil {
+		return "", err
+	}
+	if artifact.Size > 0 && int64(patched.Len()) != artifact.Size {
+		return "", fmt.Errorf("%w: 大小应为 %d 字节，实际为 %d 字节", ErrArtifactMismatch, artifact.Size, patched.Len())
+	}
+
+	localFile := u.path(u.cfg.LocalFile)
+	out, err := os.CreateTemp(filepath.Dir(localFile), filepath.Base(localFile)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	tmpFile := out.Name()
+	if _, err := out.Write(patched.Bytes()); err != nil {
+		out.Close()
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	verifier.Write(patched.Bytes())
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("同步文件失败: %v", err)
+	}
+	out.Close()
+
+	if err := verifier.verify(tmpFile); err != nil {
+		os.Remove(tmpFile)
+		return "", err
+	}
+	return tmpFile, nil
+}
+
+// GeneratePatch 生成从 oldFile 到 newFile 的 bsdiff 补丁并写入 patchFile，
+// 返回填好摘要和大小的补丁信息。需要 PATH 中有 bzip2 命令
+func GeneratePatch(oldFile, newFile, patchFile string) (Patch, error) {
+	var patch Patch
+	old, err := os.Open(oldFile)
+	if err != nil {
+		return patch, err
+	}
+	defer old.Close()
+	newer, err := os.Open(newFile)
+	if err != nil {
+		return patch, err
+	}
+	defer newer.Close()
+
+	out, err := os.Create(patchFile)
+	if err != nil {
+		return patch, err
+	}
+	if err := binarydist.Diff(old, newer, out); err != nil {
+		out.Close()
+		os.Remove(patchFile)
+		return patch, fmt.Errorf("生成补丁失败: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return patch, err
+	}
+
+	if patch.FromSHA256, err = fileSHA256(oldFile); err != nil {
+		return patch, err
+	}
+	if patch.SHA256, err = fileSHA256(patchFile); err != nil {
+		return patch, err
+	}
+	info, err := os.Stat(patchFile)
+	if err != nil {
+		return patch, err
+	}
+	patch.Size = info.Size()
+	return patch, nil
+}
@@ -0,0 +1,181 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// patchTest 本地安装了旧版本的更新器，以及旧版本到新版本的补丁
+type patchTest struct {
+	u         *Updater
+	srv       *httptest.Server
+	oldData   []byte
+	newData   []byte
+	patch     Patch
+	patchFile string
+	artifact  Artifact
+}
+
+func newPatchTest(t *testing.T) *patchTest {
+	t.Helper()
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("生成补丁需要 bzip2 命令")
+	}
+	p := &patchTest{
+		oldData: bytes.Repeat([]byte("allinone 1.2.0 binary section\n"), 200),
+	}
+	p.newData = bytes.Replace(p.oldData, []byte("1.2.0"), []byte("1.3.0"), 3)
+	p.newData = append(p.newData, "new feature\n"...)
+
+	p.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(p.patchFile)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(p.srv.Close)
+	p.u = newTestUpdater(t, staticTestConfig(p.srv))
+
+	dir := t.TempDir()
+	oldFile, newFile := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	p.patchFile = filepath.Join(dir, "patch")
+	if err := os.WriteFile(oldFile, p.oldData, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, p.newData, 0755); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := GeneratePatch(oldFile, newFile, p.patchFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch.From = "1.2.0"
+	patch.URL = p.srv.URL + "/patches/1.2.0-1.3.0.bsdiff"
+	p.patch = patch
+
+	sum := sha256.Sum256(p.newData)
+	p.artifact = Artifact{URL: p.srv.URL + "/allinone", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(p.newData)), Patches: []Patch{patch}}
+
+	if err := os.WriteFile(p.u.path(p.u.cfg.LocalFile), p.oldData, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.u.saveLocalVersion("1.2.0"); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGeneratePatch(t *testing.T) {
+	p := newPatchTest(t)
+	oldSum := sha256.Sum256(p.oldData)
+	if p.patch.FromSHA256 != hex.EncodeToString(oldSum[:]) {
+		t.Fatalf("from_sha256 应为旧版本的摘要，实际为 %s", p.patch.FromSHA256)
+	}
+	info, err := os.Stat(p.patchFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.patch.Size != info.Size() || p.patch.SHA256 == "" {
+		t.Fatalf("补丁的大小和摘要不正确: %+v", p.patch)
+	}
+	if p.patch.Size >= int64(len(p.newData)) {
+		t.Fatalf("补丁 %d 字节，不应大于新版本 %d 字节", p.patch.Size, len(p.newData))
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	p := newPatchTest(t)
+	base := p.u.path(p.u.cfg.LocalFile)
+
+	file, err := p.u.applyPatch(base, p.patchFile, p.artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	if got, _ := os.ReadFile(file); !bytes.Equal(got, p.newData) {
+		t.Fatal("应用补丁后的内容应与新版本一致")
+	}
+
+	wrongSize := p.artifact
+	wrongSize.Size++
+	wrongDigest := p.artifact
+	wrongDigest.SHA256 = strings.Repeat("0", 64)
+	otherBase := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(otherBase, bytes.ToUpper(p.oldData), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		base     string
+		artifact Artifact
+	}{
+		{"大小不一致", base, wrongSize},
+		{"摘要不一致", base, wrongDigest},
+		{"旧版本文件不同", otherBase, p.artifact},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if file, err := p.u.applyPatch(c.base, p.patchFile, c.artifact); !errors.Is(err, ErrArtifactMismatch) {
+				os.Remove(file)
+				t.Fatalf("应返回 ErrArtifactMismatch，实际错误: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchPatched(t *testing.T) {
+	p := newPatchTest(t)
+	src, err := p.u.source()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := p.u.fetchPatched(src, p.artifact, &VersionInfo{Version: "1.3.0"})
+	if file == "" {
+		t.Fatal("有适用的补丁时应通过补丁生成新版本")
+	}
+	defer os.Remove(file)
+	if got, _ := os.ReadFile(file); !bytes.Equal(got, p.newData) {
+		t.Fatal("通过补丁生成的内容应与新版本一致")
+	}
+
+	otherFrom := p.artifact
+	otherFrom.Patches = []Patch{p.patch}
+	otherFrom.Patches[0].From = "1.1.0"
+	modified := p.artifact
+	modified.Patches = []Patch{p.patch}
+	modified.Patches[0].FromSHA256 = strings.Repeat("0", 64)
+	archive := p.artifact
+	archive.Format = ARCHIVE_TAR_GZ
+
+	cases := []struct {
+		name     string
+		artifact Artifact
+		info     VersionInfo
+	}{
+		{"没有适用于本地版本的补丁", otherFrom, VersionInfo{Version: "1.3.0"}},
+		{"本地程序文件与补丁不一致", modified, VersionInfo{Version: "1.3.0"}},
+		{"压缩包", archive, VersionInfo{Version: "1.3.0"}},
+		{"带有附加文件", p.artifact, VersionInfo{Version: "1.3.0", Files: []BundleFile{{Path: "web/index.html"}}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if file := p.u.fetchPatched(src, c.artifact, &c.info); file != "" {
+				os.Remove(file)
+				t.Fatal("应下载完整制品，不使用补丁")
+			}
+		})
+	}
+}
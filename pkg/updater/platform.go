@@ -0,0 +1,312 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/cpu"
+)
+
+// libc 类型
+const (
+	LIBC_GLIBC = "glibc"
+	LIBC_MUSL  = "musl"
+)
+
+// Platform 当前运行平台。Variant 为架构变体，如 arm 的 v7、amd64 的 v3；
+// Libc 为 Linux 上动态链接器对应的 C 库，检测不到时为空
+type Platform struct {
+	OS      string
+	Arch    string
+	Variant string
+	Libc    string
+}
+
+// String 返回 os/arch[/variant][/libc] 形式的平台标识，即版本信息中 artifacts 的键
+func (p Platform) String() string {
+	parts := []string{p.OS, p.Arch}
+	if p.Variant != "" {
+		parts = append(parts, p.Variant)
+	}
+	if p.Libc != "" {
+		parts = append(parts, p.Libc)
+	}
+	return strings.Join(parts, "/")
+}
+
+// variantLadder 各架构可以向下兼容的变体，从高到低排列
+var variantLadder = map[string][]string{
+	"arm":   {"v7", "v6", "v5"},
+	"amd64": {"v4", "v3", "v2", "v1"},
+}
+
+// Keys 返回匹配 artifacts 时依次尝试的键，从最具体到最宽泛：
+// 先按变体从高到低（每个变体先带 libc 再不带），最后是不带变体的 os/arch
+func (p Platform) Keys() []string {
+	var variants []string
+	if ladder, ok := variantLadder[p.Arch]; ok && p.Variant != "" {
+		for i, v := range ladder {
+			if v == p.Variant {
+				variants = ladder[i:]
+				break
+			}
+		}
+	}
+	if variants == nil && p.Variant != "" {
+		variants = []string{p.Variant}
+	}
+
+	var keys []string
+	for _, v := range append(variants, "") {
+		q := Platform{OS: p.OS, Arch: p.Arch, Variant: v, Libc: p.Libc}
+		keys = append(keys, q.String())
+		if p.Libc != "" {
+			q.Libc = ""
+			keys = append(keys, q.String())
+		}
+	}
+	return keys
+}
+
+var (
+	platformOnce sync.Once
+	platform     Platform
+)
+
+// CurrentPlatform 检测当前运行平台，结果在进程内缓存。
+// ARM 版本取自 auxv 的 AT_PLATFORM 或 /proc/cpuinfo，amd64 微架构级别取自 CPUID，
+// 检测不到时使用编译时的 GOARM/GOAMD64 等设置
+func CurrentPlatform() Platform {
+	platformOnce.Do(func() {
+		platform = Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+		switch platform.Arch {
+		case "arm":
+			platform.Variant = detectARMVersion()
+		case "amd64":
+			platform.Variant = detectAMD64Level()
+		}
+		if platform.Variant == "" {
+			platform.Variant = buildVariant(platform.Arch)
+		}
+		if platform.OS == "linux" {
+			platform.Libc = detectLibc()
+		}
+	})
+	return platform
+}
+
+// platformHeader 向服务器报告当前平台的请求头
+func platformHeader() http.Header {
+	p := CurrentPlatform()
+	h := http.Header{}
+	h.Set("X-Platform", p.String())
+	h.Set("X-Platform-Os", p.OS)
+	h.Set("X-Platform-Arch", p.Arch)
+	if p.Variant != "" {
+		h.Set("X-Platform-Variant", p.Variant)
+	}
+	if p.Libc != "" {
+		h.Set("X-Platform-Libc", p.Libc)
+	}
+	return h
+}
+
+// buildVariant 返回编译时的架构变体设置，如 GOARM=7 写作 v7
+func buildVariant(arch string) string {
+	var setting string
+	switch arch {
+	case "arm":
+		setting = "GOARM"
+	case "amd64":
+		setting = "GOAMD64"
+	case "386":
+		setting = "GO386"
+	case "mips", "mipsle":
+		setting = "GOMIPS"
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok || setting == "" {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key != setting || s.Value == "" {
+			continue
+		}
+		if arch == "arm" {
+			// GOARM 可能带有 ,softfloat 之类的后缀
+			v, _, _ := strings.Cut(s.Value, ",")
+			return "v" + v
+		}
+		return s.Value
+	}
+	return ""
+}
+
+// AT_PLATFORM auxv 中指向平台名称字符串（如 v7l）的条目类型
+const _AT_PLATFORM = 15
+
+// detectARMVersion 检测 ARM 架构版本，返回 v5、v6、v7 或空
+func detectARMVersion() string {
+	if v := armVersionFromAuxv(); v != "" {
+		return v
+	}
+	return armVersionFromCPUInfo()
+}
+
+var armVersionPattern = regexp.MustCompile(`v(\d+)`)
+
+// armVersionFromName 从 v7l、ARMv6-compatible 之类的名称中提取版本
+func armVersionFromName(name string) string {
+	m := armVersionPattern.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch {
+	case n >= 7:
+		return "v7"
+	case n == 6:
+		return "v6"
+	case n == 5:
+		return "v5"
+	}
+	return ""
+}
+
+// armVersionFromAuxv 读取 AT_PLATFORM 指向的字符串。auxv 中只有地址，
+// 需要通过 /proc/self/mem 读取本进程内存中的内容
+func armVersionFromAuxv() string {
+	data, err := os.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return ""
+	}
+	wordSize := 4
+	if strings.HasSuffix(runtime.GOARCH, "64") {
+		wordSize = 8
+	}
+
+	var addr uint64
+	for i := 0; i+2*wordSize <= len(data); i += 2 * wordSize {
+		var key, val uint64
+		if wordSize == 4 {
+			key = uint64(binary.LittleEndian.Uint32(data[i:]))
+			val = uint64(binary.LittleEndian.Uint32(data[i+4:]))
+		} else {
+			key = binary.LittleEndian.Uint64(data[i:])
+			val = binary.LittleEndian.Uint64(data[i+8:])
+		}
+		if key == _AT_PLATFORM {
+			addr = val
+			break
+		}
+	}
+	if addr == 0 {
+		return ""
+	}
+
+	mem, err := os.Open("/proc/self/mem")
+	if err != nil {
+		return ""
+	}
+	defer mem.Close()
+	buf := make([]byte, 32)
+	n, _ := mem.ReadAt(buf, int64(addr))
+	name, _, _ := bytes.Cut(buf[:n], []byte{0})
+	return armVersionFromName(string(name))
+}
+
+// armVersionFromCPUInfo 从 /proc/cpuinfo 的 model name 或 CPU architecture 中读取版本
+func armVersionFromCPUInfo() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var arch string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch key {
+		case "model name", "Processor":
+			// 如 "ARMv6-compatible processor rev 7 (v6l)"
+			if v := armVersionFromName(val); v != "" {
+				return v
+			}
+		case "CPU architecture":
+			if arch == "" {
+				arch = val
+			}
+		}
+	}
+	return armVersionFromName("v" + arch)
+}
+
+// detectAMD64Level 按 x86-64 psABI 的微架构级别检测 CPU 支持的指令集
+func detectAMD64Level() string {
+	x := cpu.X86
+	v2 := x.HasCX16 && x.HasPOPCNT && x.HasSSE3 && x.HasSSE41 && x.HasSSE42 && x.HasSSSE3
+	v3 := v2 && x.HasAVX && x.HasAVX2 && x.HasBMI1 && x.HasBMI2 && x.HasFMA && x.HasOSXSAVE
+	v4 := v3 && x.HasAVX512F && x.HasAVX512BW && x.HasAVX512CD && x.HasAVX512DQ && x.HasAVX512VL
+	switch {
+	case v4:
+		return "v4"
+	case v3:
+		return "v3"
+	case v2:
+		return "v2"
+	}
+	return "v1"
+}
+
+// detectLibc 根据 /bin/sh 的动态链接器判断 C 库，静态链接（如部分 BusyBox）时查找系统中的动态链接器
+func detectLibc() string {
+	if f, err := elf.Open("/bin/sh"); err == nil {
+		defer f.Close()
+		for _, p := range f.Progs {
+			if p.Type != elf.PT_INTERP {
+				continue
+			}
+			data := make([]byte, p.Filesz)
+			if _, err := p.ReadAt(data, 0); err == nil {
+				if libc := libcFromLoader(string(bytes.TrimRight(data, "\x00"))); libc != "" {
+					return libc
+				}
+			}
+		}
+	}
+
+	for _, pattern := range []string{"/lib/ld-musl-*.so.1", "/lib/ld-linux*.so.*", "/lib64/ld-linux*.so.*"} {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return libcFromLoader(matches[0])
+		}
+	}
+	return ""
+}
+
+// libcFromLoader 根据动态链接器路径判断 C 库
+func libcFromLoader(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case strings.HasPrefix(name, "ld-musl"):
+		return LIBC_MUSL
+	case strings.HasPrefix(name, "ld-linux"), strings.HasPrefix(name, "ld64.so"), strings.HasPrefix(name, "ld.so"):
+		return LIBC_GLIBC
+	}
+	return ""
+}
@@ -15,18 +15,18 @@ import (
 )
 
 // 添加根据进程名停止进程的函数
-func StopProcessByName() error {
-	Logf("尝试关闭已运行的进程")
+func (u *Updater) StopProcessByName() error {
+	u.logf("尝试关闭已运行的进程")
 
 	// 获取当前进程的 PID
 	currentPID := os.Getpid()
-	Logf("当前进程 PID: %d", currentPID)
+	u.logf("当前进程 PID: %d", currentPID)
 
 	// 使用 BusyBox 兼容的 ps 命令
 	cmd := exec.Command("ps", "w")
 	output, err := cmd.Output()
 	if err != nil {
-		Logf("执行 ps 命令失败: %v", err)
+		u.logf("执行 ps 命令失败: %v", err)
 		return fmt.Errorf("执行 ps 命令失败: %v", err)
 	}
 
@@ -35,8 +35,8 @@ func StopProcessByName() error {
 
 	// 跳过标题行
 	for _, line := range lines[1:] {
-		// 检查行是否包含 "download_all"，而不是完全匹配
-		if strings.Contains(strings.ToLower(line), "download_all") {
+		// 检查行是否包含进程名，而不是完全匹配
+		if strings.Contains(strings.ToLower(line), strings.ToLower(u.cfg.ProcessName)) {
 			fields := strings.Fields(line)
 			if len(fields) >= 1 {
 				pid := fields[0]
@@ -44,24 +44,24 @@ func StopProcessByName() error {
 				// 转换 PID 为整数进行比较
 				pidInt, err := strconv.Atoi(pid)
 				if err != nil {
-					Logf("PID 转换失败: %v", err)
+					u.logf("PID 转换失败: %v", err)
 					continue
 				}
 
 				// 跳过当前进程
 				if pidInt == currentPID {
-					Logf("跳过当前进程 (PID:%s)", pid)
+					u.logf("跳过当前进程 (PID:%s)", pid)
 					continue
 				}
 
-				Logf("找到目标进程 (PID:%s), 完整进程信息: %s", pid, line)
+				u.logf("找到目标进程 (PID:%s), 完整进程信息: %s", pid, line)
 
 				// 尝试使用 kill 命令终止进程
 				killCmd := exec.Command("kill", "-9", pid)
 				if err := killCmd.Run(); err != nil {
-					Logf("关闭进程 (PID:%s) 失败: %v", pid, err)
+					u.logf("关闭进程 (PID:%s) 失败: %v", pid, err)
 				} else {
-					Logf("已成功关闭进程 (PID:%s)", pid)
+					u.logf("已成功关闭进程 (PID:%s)", pid)
 					foundProcess = true
 				}
 			}
@@ -69,7 +69,7 @@ func StopProcessByName() error {
 	}
 
 	if !foundProcess {
-		Logf("未找到其他需要关闭的进程")
+		u.logf("未找到其他需要关闭的进程")
 	} else {
 		// 如果找到并关闭了进程，等待一会确保进程完全终止
 		time.Sleep(time.Second)
@@ -79,19 +79,19 @@ func StopProcessByName() error {
 }
 
 // 通过端口号停止进程
-func stopProcessByPort(port int) error {
+func (u *Updater) stopProcessByPort(port int) error {
 	switch runtime.GOOS {
 	case "darwin": // macOS
-		return stopPortProcessDarwin(port)
+		return u.stopPortProcessDarwin(port)
 	case "linux":
-		return stopPortProcessLinux(port)
+		return u.stopPortProcessLinux(port)
 	default:
 		return fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
 	}
 }
 
 // macOS 下通过端口停止进程
-func stopPortProcessDarwin(port int) error {
+func (u *Updater) stopPortProcessDarwin(port int) error {
 	// 使用 lsof 查找占用端口的进程
 	cmd := exec.Command("lsof", "-ti", fmt.Sprintf(":%d", port))
 	output, err := cmd.Output()
@@ -106,7 +106,7 @@ func stopPortProcessDarwin(port int) error {
 		if err := killCmd.Run(); err != nil {
 			return fmt.Errorf("无法关闭占用端口的进程(PID:%s): %v", pid, err)
 		}
-		Logf("已关闭占用端口 %d 的进程(PID:%s)", port, pid)
+		u.logf("已关闭占用端口 %d 的进程(PID:%s)", port, pid)
 		// 等待端口释放
 		time.Sleep(1 * time.Second)
 	}
@@ -114,7 +114,7 @@ func stopPortProcessDarwin(port int) error {
 }
 
 // Linux 下通过端口停止进程
-func stopPortProcessLinux(port int) error {
+func (u *Updater) stopPortProcessLinux(port int) error {
 	// 使用 ss 命令查找占用端口的进程
 	cmd := exec.Command("ss", "-lptn", fmt.Sprintf("sport = :%d", port))
 	output, err := cmd.Output()
@@ -140,7 +140,7 @@ func stopPortProcessLinux(port int) error {
 			if err := killCmd.Run(); err != nil {
 				return fmt.Errorf("无法关闭占用端口的进程(PID:%s): %v", pid, err)
 			}
-			Logf("已关闭占用端口 %d 的进程(PID:%s)", port, pid)
+			u.logf("已关闭占用端口 %d 的进程(PID:%s)", port, pid)
 			// 等待端口释放
 			time.Sleep(1 * time.Second)
 		}
@@ -183,8 +183,13 @@ func getLocalIP() (string, error) {
 	return "", fmt.Errorf("未找到有效的本地 IP 地址")
 }
 
-func executeNewFile(filePath string) error {
+func (u *Updater) executeNewFile(filePath string) error {
 	cmd := exec.Command(filePath)
+	cmd.Dir = u.workDir
+	// 从压缩包安装的程序在自己的版本目录中运行，以便找到一起发布的数据文件
+	if dir, ok := u.releaseDir(filePath); ok {
+		cmd.Dir = dir
+	}
 
 	var output bytes.Buffer
 	cmd.Stdout = &output
@@ -195,24 +200,24 @@ func executeNewFile(filePath string) error {
 	}
 
 	// 等待服务启动（最多等待5秒）
-	if err := checkServiceHealth(5 * time.Second); err != nil {
+	if err := u.checkServiceHealth(5 * time.Second); err != nil {
 		return fmt.Errorf("服务启动检查失败: %v", err)
 	}
 
 	ip, err := getLocalIP()
 	if err != nil {
-		Logf("获取本地 IP 地址失败: %v", err)
+		u.logf("获取本地 IP 地址失败: %v", err)
 		return err
 	}
 
-	Logf("执行成功, 监听 %s:35455", ip)
+	u.logf("执行成功, 监听 %s:%d", ip, u.cfg.ServicePort)
 	return nil
 }
 
 // 添加一个函数来检查服务是否正常响应
-func checkServiceHealth(timeout time.Duration) error {
+func (u *Updater) checkServiceHealth(timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
-	url := "http://127.0.0.1:35455"
+	url := fmt.Sprintf("http://127.0.0.1:%d", u.cfg.ServicePort)
 	client := &http.Client{
 		Timeout: 2 * time.Second, // 单次请求超时
 	}
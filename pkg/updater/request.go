@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// doSignedRequest 发送签名请求并读取响应体，body 为 nil 表示没有请求体。
+// 服务器因时间戳偏差拒绝请求时，根据响应的 Date 头修正时间偏移后重试一次
+func (u *Updater) doSignedRequest(method, url string, body []byte, header http.Header) (*http.Response, []byte, error) {
+	client, err := u.newHTTPClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, url, reqBody)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		offset := u.clockOffset()
+		if err := u.signRequest(req, body); err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("发送请求失败: %v", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取响应失败: %v", err)
+		}
+
+		// 时间偏移可能在发送过程中因证书校验失败被修正，此时签名中的时间戳已经过时
+		changed := u.observeServerDate(resp) || u.clockOffset() != offset
+		if attempt == 0 && changed && isTimestampRejection(resp) {
+			u.logf("服务器拒绝了请求(状态码:%d)，使用修正后的时间戳重试", resp.StatusCode)
+			continue
+		}
+		return resp, data, nil
+	}
+}
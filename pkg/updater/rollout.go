@@ -0,0 +1,111 @@
+package updater
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// ROLLOUT_BUCKETS 设备分桶的数量，灰度比例精确到 0.01%
+const ROLLOUT_BUCKETS = 10000
+
+// Rollout 灰度发布设置。设备按设备 ID 和版本号计算出固定的分桶，
+// 只有分桶落在当前灰度比例内时才安装新版本
+type Rollout struct {
+	// Percentage 初始灰度比例（0-100）
+	Percentage float64 `json:"percentage"`
+	// StartTime 灰度开始时间，之前不安装；为空时立即开始
+	StartTime *time.Time `json:"start_time,omitempty"`
+	// Schedule 灰度比例随时间提升的计划，时间相对于 StartTime；没有 StartTime 时只有 after 为 0 的步骤生效
+	Schedule []RolloutStep `json:"schedule,omitempty"`
+}
+
+// RolloutStep 灰度计划中的一步：开始后经过 After 时将比例提升到 Percentage
+type RolloutStep struct {
+	After      Duration `json:"after"`
+	Percentage float64  `json:"percentage"`
+}
+
+// percentageAt 返回指定时间的灰度比例。没有开始时间时无法计算经过的时间，
+// 计划中只有 after 为 0 的步骤生效，避免整个计划立即变成全量发布
+func (r *Rollout) percentageAt(now time.Time) float64 {
+	if r.StartTime != nil && now.Before(*r.StartTime) {
+		return 0
+	}
+	pct := r.Percentage
+	for _, step := range r.Schedule {
+		if r.StartTime == nil && step.After > 0 {
+			continue
+		}
+		if r.StartTime != nil && now.Before(r.StartTime.Add(time.Duration(step.After))) {
+			continue
+		}
+		if step.Percentage > pct {
+			pct = step.Percentage
+		}
+	}
+	if pct > 100 {
+		pct = 100
+	}
+	return pct
+}
+
+// rolloutBucket 由设备 ID 和版本号计算设备的分桶（0 到 ROLLOUT_BUCKETS-1）。
+// 同一版本的分桶固定，灰度比例提升时已安装的设备始终在灰度范围内；
+// 不同版本的分桶不同，避免每次都由同一批设备先安装
+func rolloutBucket(deviceID, version string) int {
+	sum := sha256.Sum256([]byte(deviceID + ":" + version))
+	return int(binary.BigEndian.Uint64(sum[:8]) % ROLLOUT_BUCKETS)
+}
+
+// inRollout 判断当前设备是否在版本的灰度范围内，没有灰度设置时所有设备都安装
+func (u *Updater) inRollout(info *VersionInfo) bool {
+	if info.Rollout == nil {
+		return true
+	}
+	if info.Rollout.StartTime == nil && len(info.Rollout.Schedule) > 0 {
+		u.logf("版本 %s 的灰度计划没有 start_time，只使用初始比例", info.Version)
+	}
+	pct := info.Rollout.percentageAt(u.now())
+	deviceID, err := u.DeviceID()
+	if err != nil {
+		u.logf("%v，暂不更新", err)
+		return false
+	}
+	bucket := rolloutBucket(deviceID, info.Version)
+	if float64(bucket) < pct*ROLLOUT_BUCKETS/100 {
+		u.logf("设备分桶 %.2f%% 在版本 %s 的灰度比例 %.2f%% 内", float64(bucket)*100/ROLLOUT_BUCKETS, info.Version, pct)
+		return true
+	}
+	u.logf("设备分桶 %.2f%% 不在版本 %s 的灰度比例 %.2f%% 内，暂不更新", float64(bucket)*100/ROLLOUT_BUCKETS, info.Version, pct)
+	return false
+}
+
+// DeviceID 返回设备 ID，首次调用时随机生成并保存到状态文件
+func (u *Updater) DeviceID() (string, error) {
+	u.stateMu.Lock()
+	id := u.state.DeviceID
+	u.stateMu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成设备 ID 失败: %v", err)
+	}
+	id = hex.EncodeToString(b)
+	if err := u.updateState(func(st *State) {
+		// 其他进程可能已经生成并保存了设备 ID
+		if st.DeviceID == "" {
+			st.DeviceID = id
+		}
+		id = st.DeviceID
+	}); err != nil {
+		u.logf("保存设备 ID 失败: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,106 @@
+package updater
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRolloutPercentageAt(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	schedule := []RolloutStep{
+		{After: 0, Percentage: 5},
+		{After: Duration(24 * time.Hour), Percentage: 25},
+		{After: Duration(72 * time.Hour), Percentage: 150},
+	}
+
+	cases := []struct {
+		name    string
+		rollout Rollout
+		now     time.Time
+		want    float64
+	}{
+		{"只有初始比例", Rollout{Percentage: 10}, start, 10},
+		{"开始之前", Rollout{Percentage: 10, StartTime: &start, Schedule: schedule}, start.Add(-time.Second), 0},
+		{"开始时", Rollout{Percentage: 1, StartTime: &start, Schedule: schedule}, start, 5},
+		{"第一天之后", Rollout{Percentage: 1, StartTime: &start, Schedule: schedule}, start.Add(25 * time.Hour), 25},
+		{"最多 100%", Rollout{Percentage: 1, StartTime: &start, Schedule: schedule}, start.Add(100 * time.Hour), 100},
+		{"计划不会降低初始比例", Rollout{Percentage: 50, StartTime: &start, Schedule: schedule}, start.Add(25 * time.Hour), 50},
+		{"没有开始时间只使用 after 为 0 的步骤", Rollout{Percentage: 1, Schedule: schedule}, start.Add(100 * time.Hour), 5},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.rollout.percentageAt(c.now); got != c.want {
+				t.Fatalf("灰度比例应为 %v，实际为 %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestRolloutBucket(t *testing.T) {
+	if rolloutBucket("device-1", "1.2.0") != rolloutBucket("device-1", "1.2.0") {
+		t.Fatal("同一设备同一版本的分桶应固定")
+	}
+
+	// 1000 台设备在 10% 灰度下应有大约 100 台安装
+	const devices = 1000
+	in, moved := 0, 0
+	for i := 0; i < devices; i++ {
+		id := fmt.Sprintf("device-%d", i)
+		bucket := rolloutBucket(id, "1.2.0")
+		if bucket < 0 || bucket >= ROLLOUT_BUCKETS {
+			t.Fatalf("分桶 %d 超出范围", bucket)
+		}
+		if bucket < ROLLOUT_BUCKETS/10 {
+			in++
+		}
+		if bucket != rolloutBucket(id, "1.3.0") {
+			moved++
+		}
+	}
+	if math.Abs(float64(in)-devices/10) > 40 {
+		t.Fatalf("10%% 灰度下 %d 台设备中有 %d 台安装，分桶分布不均匀", devices, in)
+	}
+	if moved < devices*9/10 {
+		t.Fatalf("不同版本的分桶应不同，只有 %d 台设备的分桶发生变化", moved)
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.Source = SOURCE_STATIC
+		cfg.SourceURL = "https://example.com/manifest.json"
+		cfg.AllowUnsignedManifest = true
+	})
+	id, err := u.DeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := u.DeviceID(); again != id {
+		t.Fatalf("设备 ID 应保持不变: %s, %s", id, again)
+	}
+	bucket := float64(rolloutBucket(id, "1.2.0")) * 100 / ROLLOUT_BUCKETS
+	future := u.now().Add(time.Hour)
+
+	cases := []struct {
+		name    string
+		rollout *Rollout
+		want    bool
+	}{
+		{"没有灰度设置", nil, true},
+		{"全量", &Rollout{Percentage: 100}, true},
+		{"0%", &Rollout{Percentage: 0}, false},
+		{"分桶在比例内", &Rollout{Percentage: bucket + 0.01}, true},
+		{"分桶在比例外", &Rollout{Percentage: bucket}, false},
+		{"尚未开始", &Rollout{Percentage: 100, StartTime: &future}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := &VersionInfo{Version: "1.2.0", Rollout: c.rollout}
+			if got := u.inRollout(info); got != c.want {
+				t.Fatalf("设备分桶 %.2f%% 的灰度判断应为 %v，实际为 %v", bucket, c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// 密钥编码方式
+const (
+	KEY_ENCODING_RAW    = "raw"
+	KEY_ENCODING_HEX    = "hex"
+	KEY_ENCODING_BASE64 = "base64"
+)
+
+// SecretKeyBytes 从 secret_key、secret_key_file 或 secret_key_env 中读取密钥，
+// 按 secret_key_encoding 解码并检查长度是否为 16、24 或 32 字节。
+// 返回的错误为 *ConfigError，Field 指向出错的配置项
+func (c Config) SecretKeyBytes() ([]byte, error) {
+	return c.legacyKeySource().resolve()
+}
+
+func (c Config) legacyKeySource() keySource {
+	return keySource{
+		fields:   [4]string{"secret_key", "secret_key_file", "secret_key_env", "secret_key_encoding"},
+		key:      c.SecretKey,
+		file:     c.SecretKeyFile,
+		env:      c.SecretKeyEnv,
+		encoding: c.SecretKeyEncoding,
+	}
+}
+
+// keySource 共享密钥的来源，fields 依次为内联密钥、密钥文件、环境变量和编码方式对应的配置项名称
+type keySource struct {
+	fields   [4]string
+	key      string
+	file     string
+	env      string
+	encoding string
+}
+
+// empty 没有设置任何密钥来源
+func (s keySource) empty() bool {
+	return s.key == "" && s.file == "" && s.env == ""
+}
+
+// resolve 读取并解码密钥
+func (s keySource) resolve() ([]byte, error) {
+	switch s.encoding {
+	case "", KEY_ENCODING_RAW, KEY_ENCODING_HEX, KEY_ENCODING_BASE64:
+	default:
+		return nil, &ConfigError{Field: s.fields[3], Msg: fmt.Sprintf("只能是 raw、hex 或 base64，当前为 %q", s.encoding)}
+	}
+
+	var sources []int
+	for i, v := range []string{s.key, s.file, s.env} {
+		if v != "" {
+			sources = append(sources, i)
+		}
+	}
+	switch len(sources) {
+	case 0:
+		return nil, &ConfigError{Field: s.fields[0], Msg: fmt.Sprintf("不能为空，也可以使用 %s 或 %s", s.fields[1], s.fields[2])}
+	case 1:
+	default:
+		return nil, &ConfigError{Field: s.fields[sources[1]], Msg: fmt.Sprintf("不能与 %s 同时设置", s.fields[sources[0]])}
+	}
+
+	field := s.fields[sources[0]]
+	var raw string
+	switch sources[0] {
+	case 0:
+		raw = s.key
+	case 1:
+		data, err := readKeyFile(s.file)
+		if err != nil {
+			return nil, &ConfigError{Field: field, Msg: err.Error()}
+		}
+		raw = string(bytes.TrimSpace(data))
+	case 2:
+		v, ok := os.LookupEnv(s.env)
+		if !ok || v == "" {
+			return nil, &ConfigError{Field: field, Msg: fmt.Sprintf("指定的环境变量 %s 未设置", s.env)}
+		}
+		raw = strings.TrimSpace(v)
+	}
+
+	key, err := decodeKey(raw, s.encoding)
+	if err != nil {
+		return nil, &ConfigError{Field: field, Msg: err.Error()}
+	}
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, &ConfigError{Field: field, Msg: fmt.Sprintf("解码后的长度必须为 16、24 或 32 字节，当前为 %d 字节", len(key))}
+	}
+	return key, nil
+}
+
+// readKeyFile 读取密钥文件，拒绝同组或其他用户可以访问的文件
+func readKeyFile(path string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("密钥文件 %s 的权限 %04o 过于宽松，应为 0600 或 0400", path, fi.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	return data, nil
+}
+
+// decodeKey 按编码方式解码密钥
+func decodeKey(raw, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", KEY_ENCODING_RAW:
+		return []byte(raw), nil
+	case KEY_ENCODING_HEX:
+		key, err := hex.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("不是有效的 hex 编码: %v", err)
+		}
+		return key, nil
+	default:
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("不是有效的 base64 编码: %v", err)
+		}
+		return key, nil
+	}
+}
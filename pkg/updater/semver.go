@@ -0,0 +1,166 @@
+package updater
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer 语义化版本号（SemVer 2.0.0）
+type SemVer struct {
+	Major, Minor, Patch uint64
+	// Pre 先行版本号的各个标识符，如 1.2.0-beta.1 为 [beta 1]
+	Pre []string
+	// Build 版本编译信息，不参与比较
+	Build string
+}
+
+// ParseVersion 解析语义化版本号，允许带 v 前缀（如 build.sh 发布的 v1.2.3 标签）
+func ParseVersion(s string) (SemVer, error) {
+	var v SemVer
+	rest := strings.TrimPrefix(s, "v")
+
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+		if err := checkIdentifiers(v.Build, false); err != nil {
+			return v, fmt.Errorf("版本号 %q 的编译信息无效: %v", s, err)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		pre := rest[i+1:]
+		rest = rest[:i]
+		if err := checkIdentifiers(pre, true); err != nil {
+			return v, fmt.Errorf("版本号 %q 的先行版本号无效: %v", s, err)
+		}
+		v.Pre = strings.Split(pre, ".")
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("版本号 %q 不是 x.y.z 格式", s)
+	}
+	nums := make([]uint64, 3)
+	for i, p := range parts {
+		if !isNumeric(p) || (len(p) > 1 && p[0] == '0') {
+			return v, fmt.Errorf("版本号 %q 的第 %d 段 %q 无效", s, i+1, p)
+		}
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("版本号 %q 的第 %d 段 %q 无效", s, i+1, p)
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	return v, nil
+}
+
+// checkIdentifiers 检查以点分隔的标识符只包含字母、数字和连字符，先行版本号的数字标识符不能有前导零
+func checkIdentifiers(s string, pre bool) error {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return fmt.Errorf("标识符不能为空")
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return fmt.Errorf("标识符 %q 包含无效字符", id)
+			}
+		}
+		if pre && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return fmt.Errorf("数字标识符 %q 不能有前导零", id)
+		}
+	}
+	return nil
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String 返回不带 v 前缀的版本号
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + strings.Join(v.Pre, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare 按 SemVer 2.0.0 的优先级规则比较版本号，返回 -1、0 或 1
+func (v SemVer) Compare(o SemVer) int {
+	for _, d := range [][2]uint64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// 有先行版本号的版本优先级较低
+	switch {
+	case len(v.Pre) == 0 && len(o.Pre) == 0:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Pre) && i < len(o.Pre); i++ {
+		if c := compareIdentifier(v.Pre[i], o.Pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Pre) < len(o.Pre):
+		return -1
+	case len(v.Pre) > len(o.Pre):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifier 数字标识符按数值比较且低于非数字标识符，非数字标识符按 ASCII 顺序比较
+func compareIdentifier(a, b string) int {
+	an, bn := isNumeric(a), isNumeric(b)
+	switch {
+	case an && bn:
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// CompareVersions 比较两个版本号字符串
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
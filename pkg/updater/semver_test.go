@@ -0,0 +1,75 @@
+package updater
+
+import "testing"
+
+// SemVer 2.0.0 第 11 节中按从低到高排列的示例
+func TestSemVerPrereleaseOrdering(t *testing.T) {
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1-0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			got, err := CompareVersions(ordered[i], ordered[j])
+			if err != nil {
+				t.Fatalf("CompareVersions(%q, %q): %v", ordered[i], ordered[j], err)
+			}
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got != want {
+				t.Errorf("CompareVersions(%q, %q) = %d，应为 %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+}
+
+func TestSemVerIgnoresBuildAndPrefix(t *testing.T) {
+	cases := [][2]string{
+		{"1.2.3+build.5", "1.2.3"},
+		{"v1.2.3", "1.2.3"},
+		{"v1.2.3-rc.1+sha.abc", "1.2.3-rc.1"},
+	}
+	for _, c := range cases {
+		got, err := CompareVersions(c[0], c[1])
+		if err != nil {
+			t.Fatalf("CompareVersions(%q, %q): %v", c[0], c[1], err)
+		}
+		if got != 0 {
+			t.Errorf("CompareVersions(%q, %q) = %d，应为 0", c[0], c[1], got)
+		}
+	}
+}
+
+func TestParseVersionRejectsInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"1.2",
+		"1.2.3.4",
+		"01.2.3",
+		"1.2.3-",
+		"1.2.3-01",
+		"1.2.3-beta..1",
+		"1.2.3+",
+		"1.2.3-beta_1",
+		"a.b.c",
+	} {
+		if _, err := ParseVersion(s); err == nil {
+			t.Errorf("ParseVersion(%q) 应返回错误", s)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 更新源类型
+const (
+	// SOURCE_API 加密的版本接口（api_url），设置了 tuf_metadata_url 时通过 TUF 元数据获取
+	SOURCE_API = "api"
+	// SOURCE_STATIC 通过 HTTP(S) 获取的明文 JSON 版本信息
+	SOURCE_STATIC = "static"
+	// SOURCE_DIR 本地目录中的版本信息和制品
+	SOURCE_DIR = "dir"
+	// SOURCE_GITHUB GitHub Releases 接口
+	SOURCE_GITHUB = "github"
+)
+
+// SOURCE_DIR_MANIFEST 本地目录更新源中版本信息文件的名称
+const SOURCE_DIR_MANIFEST = "manifest.json"
+
+// MAX_MANIFEST_SIZE 明文版本信息的最大字节数
+const MAX_MANIFEST_SIZE = 1 << 20
+
+// Source 更新源，提供最新的版本信息和制品内容
+type Source interface {
+	// Latest 获取最新的版本信息，制品地址应为 Fetch 可以打开的地址
+	Latest() (*VersionInfo, error)
+	// Fetch 打开制品内容，url 为制品的下载地址，可能带有代理前缀
+	Fetch(url string) (io.ReadCloser, error)
+}
+
+// WithSource 使用自定义的更新源，替代配置中的 source
+func WithSource(src Source) Option {
+	return func(u *Updater) {
+		u.customSource = src
+	}
+}
+
+// source 按配置创建更新源
+func (u *Updater) source() (Source, error) {
+	if u.customSource != nil {
+		return u.customSource, nil
+	}
+	switch u.cfg.Source {
+	case "", SOURCE_API:
+		return &apiSource{u: u}, nil
+	case SOURCE_STATIC:
+		return &staticSource{u: u, url: u.cfg.SourceURL}, nil
+	case SOURCE_DIR:
+		return &dirSource{u: u, dir: u.path(u.cfg.SourceDir)}, nil
+	case SOURCE_GITHUB:
+		return u.newGitHubSource()
+	}
+	return nil, fmt.Errorf("不支持的更新源: %s", u.cfg.Source)
+}
+
+// apiSource 加密的版本接口
+type apiSource struct {
+	u *Updater
+}
+
+func (s *apiSource) Latest() (*VersionInfo, error) {
+	return s.u.getRemoteVersion()
+}
+
+func (s *apiSource) Fetch(url string) (io.ReadCloser, error) {
+	return s.u.httpFetch(url, nil)
+}
+
+// staticSource 通过 HTTP(S) 获取的明文 JSON 版本信息，配置了版本信息公钥时必须带有效签名。
+// 制品地址可以是相对于版本信息地址的相对路径
+type staticSource struct {
+	u   *Updater
+	url string
+}
+
+func (s *staticSource) Latest() (*VersionInfo, error) {
+	data, err := s.u.httpGet(s.url, s.u.manifestHeader(), MAX_MANIFEST_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.u.parseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("版本信息地址无效: %v", err)
+	}
+	resolveArtifactURLs(info, func(ref string) string {
+		if r, err := base.Parse(ref); err == nil {
+			return r.String()
+		}
+		return ref
+	})
+	return info, nil
+}
+
+func (s *staticSource) Fetch(url string) (io.ReadCloser, error) {
+	return s.u.httpFetch(url, nil)
+}
+
+// dirSource 本地目录中的版本信息（manifest.json）和制品，如挂载的 U 盘或共享目录。
+// 制品地址可以是相对于该目录的路径，也可以是 http(s) 地址
+type dirSource struct {
+	u   *Updater
+	dir string
+}
+
+func (s *dirSource) Latest() (*VersionInfo, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, SOURCE_DIR_MANIFEST))
+	if err != nil {
+		return nil, fmt.Errorf("读取版本信息失败: %v", err)
+	}
+	info, err := s.u.parseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resolveArtifactURLs(info, func(ref string) string {
+		if isHTTPURL(ref) || filepath.IsAbs(ref) {
+			return ref
+		}
+		return filepath.Join(s.dir, filepath.FromSlash(strings.TrimPrefix(ref, "file://")))
+	})
+	return info, nil
+}
+
+func (s *dirSource) Fetch(url string) (io.ReadCloser, error) {
+	if isHTTPURL(url) {
+		return s.u.httpFetch(url, nil)
+	}
+	f, err := os.Open(strings.TrimPrefix(url, "file://"))
+	if err != nil {
+		return nil, fmt.Errorf("打开制品失败: %v", err)
+	}
+	return f, nil
+}
+
+// parseManifest 校验明文版本信息的签名并解析
+func (u *Updater) parseManifest(data []byte) (*VersionInfo, error) {
+	manifest, err := u.verifyManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	var info VersionInfo
+	if err := json.Unmarshal(manifest, &info); err != nil {
+		return nil, fmt.Errorf("解析版本信息失败: %v", err)
+	}
+	return &info, nil
+}
+
+// resolveArtifactURLs 使用 resolve 转换版本信息中所有制品、差分补丁、附加文件和镜像的地址，包括各频道的版本
+func resolveArtifactURLs(info *VersionInfo, resolve func(string) string) {
+	fix := func(a *Artifact) {
+		if a.URL != "" {
+			a.URL = resolve(a.URL)
+		}
+		for i, m := range a.Mirrors {
+			a.Mirrors[i] = resolve(m)
+		}
+		for i := range a.Patches {
+			p := &a.Patches[i]
+			if p.URL != "" {
+				p.URL = resolve(p.URL)
+			}
+			for j, m := range p.Mirrors {
+				p.Mirrors[j] = resolve(m)
+			}
+		}
+	}
+	if info.DownloadUrl != "" {
+		info.DownloadUrl = resolve(info.DownloadUrl)
+	}
+	for key, a := range info.Artifacts {
+		fix(&a)
+		info.Artifacts[key] = a
+	}
+	for _, a := range []*Artifact{&info.Amd64, &info.Arm64, &info.Arm, &info.Darwin} {
+		fix(a)
+	}
+	for i := range info.Files {
+		f := &info.Files[i]
+		if f.URL != "" {
+			f.URL = resolve(f.URL)
+		}
+		for j, m := range f.Mirrors {
+			f.Mirrors[j] = resolve(m)
+		}
+	}
+	for name, ci := range info.Channels {
+		resolveArtifactURLs(&ci, resolve)
+		info.Channels[name] = ci
+	}
+}
+
+// isHTTPURL 判断是否为 http(s) 地址
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// newDownloadClient 创建下载制品使用的 HTTP 客户端
+func (u *Updater) newDownloadClient() (*http.Client, error) {
+	transport, err := u.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	transport.DisableKeepAlives = true
+	return &http.Client{
+		Timeout:   time.Duration(u.cfg.DownloadTimeout),
+		Transport: &clockSyncTransport{u: u, base: transport},
+	}, nil
+}
+
+// httpFetch 发送 GET 请求下载制品，状态码不是 200 时返回错误
+func (u *Updater) httpFetch(url string, header http.Header) (io.ReadCloser, error) {
+	client, err := u.newDownloadClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", u.cfg.UserAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP请求失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP状态码错误: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// httpGet 发送 GET 请求并读取不超过 limit 字节的响应体
+func (u *Updater) httpGet(url string, header http.Header, limit int64) ([]byte, error) {
+	client, err := u.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", u.cfg.UserAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("服务器返回错误(状态码:%d): %s", resp.StatusCode, string(data))
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("响应超过 %d 字节", limit)
+	}
+	return data, nil
+}
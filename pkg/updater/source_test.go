@@ -0,0 +1,103 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// staticTestConfig 使用 srv 上 /releases/manifest.json 作为更新源
+func staticTestConfig(srv *httptest.Server) func(cfg *Config) {
+	return func(cfg *Config) {
+		cfg.Source = SOURCE_STATIC
+		cfg.SourceURL = srv.URL + "/releases/manifest.json"
+		cfg.AllowUnsignedManifest = true
+	}
+}
+
+// serveStaticRelease 提供版本信息和相对路径的制品，manifestSHA256 为版本信息中声明的摘要
+func serveStaticRelease(t *testing.T, binary []byte, manifestSHA256 string) *httptest.Server {
+	t.Helper()
+	manifest, err := json.Marshal(VersionInfo{
+		Version: "1.2.0",
+		Artifacts: map[string]Artifact{
+			CurrentPlatform().String(): {URL: "v1.2.0/allinone", SHA256: manifestSHA256, Size: int64(len(binary))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(manifest)
+	})
+	mux.HandleFunc("/releases/v1.2.0/allinone", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStaticSourceRoundTrip(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho allinone\n")
+	sum := sha256.Sum256(binary)
+	srv := serveStaticRelease(t, binary, hex.EncodeToString(sum[:]))
+	u := newTestUpdater(t, staticTestConfig(srv))
+
+	src, err := u.source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := src.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.2.0" {
+		t.Fatalf("版本应为 1.2.0，实际为 %s", info.Version)
+	}
+	artifact := u.getPlatformArtifact(info)
+	if want := srv.URL + "/releases/v1.2.0/allinone"; artifact.URL != want {
+		t.Fatalf("相对地址应解析为 %s，实际为 %s", want, artifact.URL)
+	}
+
+	file, err := u.fetchArtifact(src, artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(binary) {
+		t.Fatalf("下载的内容不一致: %q", data)
+	}
+}
+
+func TestStaticSourceRejectsMismatchedArtifact(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho allinone\n")
+	sum := sha256.Sum256([]byte("其他内容"))
+	srv := serveStaticRelease(t, binary, hex.EncodeToString(sum[:]))
+	u := newTestUpdater(t, staticTestConfig(srv))
+
+	src, err := u.source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := src.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.fetchArtifact(src, u.getPlatformArtifact(info)); !errors.Is(err, ErrArtifactMismatch) {
+		t.Fatalf("摘要不一致时应拒绝制品，实际错误: %v", err)
+	}
+	if _, err := os.Stat(u.path(u.cfg.LocalFile) + ".rejected"); err != nil {
+		t.Fatalf("应保留校验失败的文件: %v", err)
+	}
+}
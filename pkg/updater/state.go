@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// State 更新器在运行过程中持久化的状态，保存在 state_file 中
+type State struct {
+	// ClockOffset 服务器时间与本地时间的差值，用于在没有 RTC 的设备上修正请求签名和日志时间
+	ClockOffset Duration `json:"clock_offset,omitempty"`
+	// DeviceID 随机生成的设备 ID，用于灰度发布分桶
+	DeviceID string `json:"device_id,omitempty"`
+	// Mirrors 按线路记录的下载成功率、延迟和速度，用于选择下载线路
+	Mirrors map[string]*MirrorStats `json:"mirrors,omitempty"`
+	// ConfigFiles 上次安装的默认配置文件的 SHA-256，用于判断用户是否修改过配置文件
+	ConfigFiles map[string]string `json:"config_files,omitempty"`
+	// Channel 通过 channel 命令切换的发布频道，优先于配置中的 channel
+	Channel string `json:"channel,omitempty"`
+	// ChannelSwitch 切换频道后尚未安装新频道的版本，此时允许降级
+	ChannelSwitch bool `json:"channel_switch,omitempty"`
+}
+
+// loadState 读取状态文件，文件不存在时返回空状态
+func (u *Updater) loadState() (State, error) {
+	var st State
+	data, err := os.ReadFile(u.path(u.cfg.StateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("读取状态文件失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("解析状态文件失败: %v", err)
+	}
+	return st, nil
+}
+
+// reloadState 重新读取状态文件，获取其他进程（如 channel 命令）保存的修改
+func (u *Updater) reloadState() {
+	st, err := u.loadState()
+	if err != nil {
+		u.logf("%v", err)
+		return
+	}
+	u.stateMu.Lock()
+	u.state = st
+	u.stateMu.Unlock()
+}
+
+// updateState 修改并原子地保存状态。修改前重新读取状态文件，避免覆盖其他进程保存的修改
+func (u *Updater) updateState(fn func(*State)) error {
+	u.stateMu.Lock()
+	defer u.stateMu.Unlock()
+
+	if st, err := u.loadState(); err == nil {
+		u.state = st
+	}
+	fn(&u.state)
+	data, err := json.MarshalIndent(u.state, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := u.path(u.cfg.StateFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("保存状态文件失败: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("保存状态文件失败: %v", err)
+	}
+	return nil
+}
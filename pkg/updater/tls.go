@@ -0,0 +1,131 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrTLSPinMismatch 服务器证书链中没有与 tls_pins 匹配的公钥
+var ErrTLSPinMismatch = errors.New("证书链中没有与 tls_pins 匹配的公钥")
+
+// tlsConfig 根据 tls_ca_file、tls_cert_file/tls_key_file 和 tls_pins 构造 TLS 配置，
+// 更新器发出的所有 HTTPS 请求都使用该配置
+func (c Config) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.TLSCAFile != "" {
+		data, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, &ConfigError{Field: "tls_ca_file", Msg: fmt.Sprintf("读取失败: %v", err)}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, &ConfigError{Field: "tls_ca_file", Msg: "中没有有效的 PEM 证书"}
+		}
+		conf.RootCAs = pool
+	}
+
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		if c.TLSCertFile == "" || c.TLSKeyFile == "" {
+			return nil, &ConfigError{Field: "tls_cert_file", Msg: "必须与 tls_key_file 同时设置"}
+		}
+		if _, err := readKeyFile(c.TLSKeyFile); err != nil {
+			return nil, &ConfigError{Field: "tls_key_file", Msg: err.Error()}
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, &ConfigError{Field: "tls_cert_file", Msg: fmt.Sprintf("加载客户端证书失败: %v", err)}
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.TLSPins) > 0 {
+		pins := make(map[string]map[string]bool)
+		for host, hashes := range c.TLSPins {
+			set := make(map[string]bool)
+			for _, h := range hashes {
+				sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(h, "sha256/"))
+				if err != nil || len(sum) != sha256.Size {
+					return nil, &ConfigError{Field: "tls_pins", Msg: fmt.Sprintf("主机 %s 的 %q 不是有效的 SHA-256 SPKI 摘要", host, h)}
+				}
+				set[string(sum)] = true
+			}
+			pins[strings.ToLower(host)] = set
+		}
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPins(pins, cs)
+		}
+	}
+
+	return conf, nil
+}
+
+// checkPins 检查证书链中是否有与主机固定的公钥匹配的证书。
+// 通过 IP 地址访问时不发送 SNI，此时按已通过校验的服务器证书中的 IP 地址查找
+func checkPins(pins map[string]map[string]bool, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	hosts := []string{strings.ToLower(cs.ServerName)}
+	if cs.ServerName == "" {
+		hosts = hosts[:0]
+		for _, ip := range cs.PeerCertificates[0].IPAddresses {
+			hosts = append(hosts, ip.String())
+		}
+	}
+
+	for _, host := range hosts {
+		set, ok := pins[host]
+		if !ok {
+			continue
+		}
+		matched := false
+		for _, cert := range cs.PeerCertificates {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if set[string(sum[:])] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%w: 服务器 %s", ErrTLSPinMismatch, host)
+		}
+	}
+	return nil
+}
+
+// newTransport 创建使用 TLS 配置的 Transport
+func (u *Updater) newTransport() (*http.Transport, error) {
+	conf, err := u.cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	// 证书有效期按修正后的时间校验，不采用向后的偏移
+	conf.Time = u.trustedNow
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       conf,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	}, nil
+}
+
+// newHTTPClient 创建请求版本接口和元数据使用的 HTTP 客户端
+func (u *Updater) newHTTPClient() (*http.Client, error) {
+	transport, err := u.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   time.Duration(u.cfg.RequestTimeout),
+		Transport: &clockSyncTransport{u: u, base: transport},
+	}, nil
+}
@@ -0,0 +1,71 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	cert := srv.Certificate()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+	other := sha256.Sum256([]byte("other"))
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(other[:])
+
+	cases := []struct {
+		name string
+		pins map[string][]string
+		ok   bool
+	}{
+		{"没有固定公钥", nil, true},
+		{"公钥匹配", map[string][]string{"127.0.0.1": {otherPin, pin}}, true},
+		{"公钥不匹配", map[string][]string{"127.0.0.1": {otherPin}}, false},
+		{"其他主机的固定公钥", map[string][]string{"update.example.com": {otherPin}}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u := newTestUpdater(t, func(cfg *Config) {
+				cfg.Source = SOURCE_STATIC
+				cfg.SourceURL = srv.URL + "/manifest.json"
+				cfg.AllowUnsignedManifest = true
+				cfg.TLSCAFile = caFile
+				cfg.TLSPins = c.pins
+			})
+			client, err := u.newHTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(srv.URL)
+			if c.ok {
+				if err != nil {
+					t.Fatalf("握手应成功: %v", err)
+				}
+				resp.Body.Close()
+				return
+			}
+			if err == nil {
+				resp.Body.Close()
+				t.Fatal("公钥不匹配时握手应失败")
+			}
+			if !errors.Is(err, ErrTLSPinMismatch) {
+				t.Fatalf("应因 tls_pins 不匹配而失败，实际错误: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TUF 元数据单个文件的最大大小
+const TUF_MAX_METADATA_SIZE = 1 << 20
+
+// TUF 角色名称
+const (
+	TUF_ROLE_ROOT      = "root"
+	TUF_ROLE_TIMESTAMP = "timestamp"
+	TUF_ROLE_SNAPSHOT  = "snapshot"
+	TUF_ROLE_TARGETS   = "targets"
+)
+
+// errTUFNotFound 服务器上不存在请求的元数据文件
+var errTUFNotFound = errors.New("元数据不存在")
+
+var (
+	// ErrTUFSignature 元数据没有达到角色阈值数量的有效签名
+	ErrTUFSignature = errors.New("TUF 元数据签名无效")
+	// ErrTUFRollback 元数据的版本号低于本地已信任的版本，可能是回滚攻击
+	ErrTUFRollback = errors.New("TUF 元数据版本回退")
+	// ErrTUFExpired 元数据已过期，可能是冻结攻击
+	ErrTUFExpired = errors.New("TUF 元数据已过期")
+)
+
+// TUFEnvelope TUF 元数据文件，签名覆盖 Signed 的原始字节
+type TUFEnvelope struct {
+	Signed     json.RawMessage     `json:"signed"`
+	Signatures []ManifestSignature `json:"signatures"`
+}
+
+// TUFHeader 所有角色元数据共有的字段
+type TUFHeader struct {
+	Type    string    `json:"_type"`
+	Version int64     `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+// TUFKey 元数据签名公钥，目前只支持 ed25519，公钥为 hex 编码
+type TUFKey struct {
+	KeyType string `json:"keytype"`
+	KeyVal  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+// TUFRole 角色使用的公钥 ID 和签名阈值
+type TUFRole struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// TUFRoot root 角色元数据，定义其他角色的公钥和阈值
+type TUFRoot struct {
+	TUFHeader
+	Keys  map[string]TUFKey  `json:"keys"`
+	Roles map[string]TUFRole `json:"roles"`
+}
+
+// TUFMetaFile timestamp 和 snapshot 中对其他元数据文件的描述
+type TUFMetaFile struct {
+	Version int64             `json:"version"`
+	Length  int64             `json:"length,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// TUFTimestamp timestamp 角色元数据，指向最新的 snapshot.json
+type TUFTimestamp struct {
+	TUFHeader
+	Meta map[string]TUFMetaFile `json:"meta"`
+}
+
+// TUFSnapshot snapshot 角色元数据，记录 targets.json 的版本
+type TUFSnapshot struct {
+	TUFHeader
+	Meta map[string]TUFMetaFile `json:"meta"`
+}
+
+// TUFTargets targets 角色元数据，Custom 为版本信息
+type TUFTargets struct {
+	TUFHeader
+	Custom json.RawMessage `json:"custom"`
+}
+
+// tufClient 按 root → timestamp → snapshot → targets 的顺序更新并校验元数据，
+// 已信任的元数据保存在 dir 中，用于拒绝版本回退和过期的元数据
+type tufClient struct {
+	u      *Updater
+	client *http.Client
+	base   string
+	dir    string
+	now    time.Time
+}
+
+// getTUFVersion 通过 TUF 元数据获取版本信息
+func (u *Updater) getTUFVersion() (*VersionInfo, error) {
+	client, err := u.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	c := &tufClient{
+		u:      u,
+		client: client,
+		base:   strings.TrimSuffix(u.cfg.TUFMetadataUrl, "/") + "/",
+		dir:    u.path(u.cfg.TUFMetadataDir),
+		now:    u.trustedNow(),
+	}
+	manifest, err := c.update()
+	if err != nil {
+		return nil, fmt.Errorf("TUF 元数据校验失败: %w", err)
+	}
+
+	var versionInfo VersionInfo
+	if err := json.Unmarshal(manifest, &versionInfo); err != nil {
+		return nil, fmt.Errorf("解析版本信息失败: %v", err)
+	}
+	return &versionInfo, nil
+}
+
+// update 更新全部元数据，返回 targets 中的版本信息
+func (c *tufClient) update() (json.RawMessage, error) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建元数据目录失败: %v", err)
+	}
+
+	root, err := c.loadTrustedRoot()
+	if err != nil {
+		return nil, err
+	}
+	if root, err = c.updateRoot(root); err != nil {
+		return nil, err
+	}
+	if err := c.checkExpiry(TUF_ROLE_ROOT, root.TUFHeader); err != nil {
+		return nil, err
+	}
+
+	timestamp, err := c.updateTimestamp(root)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := c.updateSnapshot(root, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := c.updateTargets(root, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(targets.Custom) == 0 {
+		return nil, fmt.Errorf("targets 元数据中没有版本信息")
+	}
+	c.u.logf("TUF 元数据校验通过: root v%d, timestamp v%d, snapshot v%d, targets v%d",
+		root.Version, timestamp.Version, snapshot.Version, targets.Version)
+	return targets.Custom, nil
+}
+
+// loadTrustedRoot 读取本地信任的 root，首次运行时使用 tuf_root_file 并校验其自签名
+func (c *tufClient) loadTrustedRoot() (*TUFRoot, error) {
+	var root TUFRoot
+	data, err := os.ReadFile(filepath.Join(c.dir, "root.json"))
+	if err == nil {
+		if _, err := decodeTUF(data, TUF_ROLE_ROOT, &root); err != nil {
+			return nil, fmt.Errorf("本地 root.json 无效: %v", err)
+		}
+		return &root, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("读取本地 root.json 失败: %v", err)
+	}
+
+	data, err = os.ReadFile(c.u.path(c.u.cfg.TUFRootFile))
+	if err != nil {
+		return nil, fmt.Errorf("读取初始 root 失败: %v", err)
+	}
+	env, err := decodeTUF(data, TUF_ROLE_ROOT, &root)
+	if err != nil {
+		return nil, fmt.Errorf("初始 root 无效: %v", err)
+	}
+	if err := verifyTUFRole(&root, TUF_ROLE_ROOT, env); err != nil {
+		return nil, fmt.Errorf("初始 root: %w", err)
+	}
+	if err := c.save("root.json", data); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// updateRoot 依次获取 N+1.root.json 直到不存在，新 root 必须同时满足旧 root 和自身的签名阈值
+func (c *tufClient) updateRoot(root *TUFRoot) (*TUFRoot, error) {
+	for {
+		next := root.Version + 1
+		data, err := c.fetch(fmt.Sprintf("%d.root.json", next))
+		if errors.Is(err, errTUFNotFound) {
+			return root, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var newRoot TUFRoot
+		env, err := decodeTUF(data, TUF_ROLE_ROOT, &newRoot)
+		if err != nil {
+			return nil, fmt.Errorf("%d.root.json 无效: %v", next, err)
+		}
+		if err := verifyTUFRole(root, TUF_ROLE_ROOT, env); err != nil {
+			return nil, fmt.Errorf("%d.root.json 未被当前 root 认可: %w", next, err)
+		}
+		if err := verifyTUFRole(&newRoot, TUF_ROLE_ROOT, env); err != nil {
+			return nil, fmt.Errorf("%d.root.json: %w", next, err)
+		}
+		if newRoot.Version != next {
+			return nil, fmt.Errorf("%d.root.json 的版本号为 %d", next, newRoot.Version)
+		}
+
+		// timestamp 或 snapshot 的公钥变化后丢弃旧的元数据，以便从密钥泄露后的版本号攻击中恢复
+		for _, role := range []string{TUF_ROLE_TIMESTAMP, TUF_ROLE_SNAPSHOT} {
+			if !reflect.DeepEqual(root.Roles[role], newRoot.Roles[role]) {
+				os.Remove(filepath.Join(c.dir, "timestamp.json"))
+				os.Remove(filepath.Join(c.dir, "snapshot.json"))
+				break
+			}
+		}
+		if err := c.save("root.json", data); err != nil {
+			return nil, err
+		}
+		c.u.logf("TUF root 已更新到 v%d", next)
+		root = &newRoot
+	}
+}
+
+// updateTimestamp 获取并校验 timestamp.json
+func (c *tufClient) updateTimestamp(root *TUFRoot) (*TUFTimestamp, error) {
+	data, err := c.fetch("timestamp.json")
+	if err != nil {
+		return nil, err
+	}
+	var ts TUFTimestamp
+	if err := c.verifyNew(root, TUF_ROLE_TIMESTAMP, data, &ts, &ts.TUFHeader); err != nil {
+		return nil, err
+	}
+	if _, ok := ts.Meta["snapshot.json"]; !ok {
+		return nil, fmt.Errorf("timestamp 中没有 snapshot.json")
+	}
+
+	var trusted TUFTimestamp
+	if c.loadTrusted("timestamp.json", &trusted) {
+		if ts.Meta["snapshot.json"].Version < trusted.Meta["snapshot.json"].Version {
+			return nil, fmt.Errorf("%w: timestamp 中的 snapshot 版本 %d 低于已信任的 %d", ErrTUFRollback, ts.Meta["snapshot.json"].Version, trusted.Meta["snapshot.json"].Version)
+		}
+	}
+	if err := c.save("timestamp.json", data); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// updateSnapshot 获取并校验 snapshot.json
+func (c *tufClient) updateSnapshot(root *TUFRoot, ts *TUFTimestamp) (*TUFSnapshot, error) {
+	meta := ts.Meta["snapshot.json"]
+	data, err := c.fetch("snapshot.json")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTUFMetaFile("snapshot.json", meta, data); err != nil {
+		return nil, err
+	}
+	var snap TUFSnapshot
+	if err := c.verifyNew(root, TUF_ROLE_SNAPSHOT, data, &snap, &snap.TUFHeader); err != nil {
+		return nil, err
+	}
+	if snap.Version != meta.Version {
+		return nil, fmt.Errorf("snapshot 版本为 %d，与 timestamp 中的 %d 不一致", snap.Version, meta.Version)
+	}
+	if _, ok := snap.Meta["targets.json"]; !ok {
+		return nil, fmt.Errorf("snapshot 中没有 targets.json")
+	}
+
+	var trusted TUFSnapshot
+	if c.loadTrusted("snapshot.json", &trusted) {
+		if snap.Meta["targets.json"].Version < trusted.Meta["targets.json"].Version {
+			return nil, fmt.Errorf("%w: snapshot 中的 targets 版本 %d 低于已信任的 %d", ErrTUFRollback, snap.Meta["targets.json"].Version, trusted.Meta["targets.json"].Version)
+		}
+	}
+	if err := c.save("snapshot.json", data); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// updateTargets 获取并校验 targets.json
+func (c *tufClient) updateTargets(root *TUFRoot, snap *TUFSnapshot) (*TUFTargets, error) {
+	meta := snap.Meta["targets.json"]
+	data, err := c.fetch("targets.json")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTUFMetaFile("targets.json", meta, data); err != nil {
+		return nil, err
+	}
+	var targets TUFTargets
+	if err := c.verifyNew(root, TUF_ROLE_TARGETS, data, &targets, &targets.TUFHeader); err != nil {
+		return nil, err
+	}
+	if targets.Version != meta.Version {
+		return nil, fmt.Errorf("targets 版本为 %d，与 snapshot 中的 %d 不一致", targets.Version, meta.Version)
+	}
+	if err := c.save("targets.json", data); err != nil {
+		return nil, err
+	}
+	return &targets, nil
+}
+
+// verifyNew 校验新获取的元数据的签名和有效期，并拒绝版本号低于本地已信任版本的元数据
+func (c *tufClient) verifyNew(root *TUFRoot, role string, data []byte, v interface{}, header *TUFHeader) error {
+	env, err := decodeTUF(data, role, v)
+	if err != nil {
+		return fmt.Errorf("%s 元数据无效: %v", role, err)
+	}
+	if err := verifyTUFRole(root, role, env); err != nil {
+		return fmt.Errorf("%s 元数据: %w", role, err)
+	}
+
+	var trusted TUFHeader
+	if c.loadTrusted(role+".json", &trusted) && header.Version < trusted.Version {
+		return fmt.Errorf("%w: %s 元数据版本 %d 低于已信任的 %d", ErrTUFRollback, role, header.Version, trusted.Version)
+	}
+	return c.checkExpiry(role, *header)
+}
+
+// checkExpiry 拒绝过期的元数据，防止冻结攻击
+func (c *tufClient) checkExpiry(role string, header TUFHeader) error {
+	if !c.now.Before(header.Expires) {
+		return fmt.Errorf("%w: %s 元数据已于 %s 过期", ErrTUFExpired, role, header.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// loadTrusted 读取本地已信任的元数据，不存在或无法解析时返回 false
+func (c *tufClient) loadTrusted(name string, v interface{}) bool {
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return false
+	}
+	var env TUFEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return false
+	}
+	return json.Unmarshal(env.Signed, v) == nil
+}
+
+// save 原子地保存元数据
+func (c *tufClient) save(name string, data []byte) error {
+	path := filepath.Join(c.dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("保存 %s 失败: %v", name, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("保存 %s 失败: %v", name, err)
+	}
+	return nil
+}
+
+// fetch 下载元数据文件，大小超过 TUF_MAX_METADATA_SIZE 时返回错误
+func (c *tufClient) fetch(name string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.base+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.u.cfg.UserAgent)
+	for k, v := range c.u.manifestHeader() {
+		req.Header[k] = v
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 失败: %v", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errTUFNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取 %s 失败(状态码:%d)", name, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, TUF_MAX_METADATA_SIZE+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", name, err)
+	}
+	if len(data) > TUF_MAX_METADATA_SIZE {
+		return nil, fmt.Errorf("%s 超过 %d 字节", name, TUF_MAX_METADATA_SIZE)
+	}
+	return data, nil
+}
+
+// decodeTUF 解析元数据文件并检查角色类型
+func decodeTUF(data []byte, role string, v interface{}) (*TUFEnvelope, error) {
+	var env TUFEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	var header TUFHeader
+	if err := json.Unmarshal(env.Signed, &header); err != nil {
+		return nil, err
+	}
+	if header.Type != role {
+		return nil, fmt.Errorf("类型应为 %s，实际为 %q", role, header.Type)
+	}
+	if err := json.Unmarshal(env.Signed, v); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// verifyTUFRole 检查元数据是否带有达到角色阈值数量的、来自不同公钥的有效签名
+func verifyTUFRole(root *TUFRoot, role string, env *TUFEnvelope) error {
+	r, ok := root.Roles[role]
+	if !ok || r.Threshold < 1 {
+		return fmt.Errorf("root 中没有有效的 %s 角色定义", role)
+	}
+
+	allowed := make(map[string]bool)
+	for _, id := range r.KeyIDs {
+		allowed[id] = true
+	}
+	verified := make(map[string]bool)
+	for _, s := range env.Signatures {
+		if !allowed[s.KeyID] || verified[s.KeyID] {
+			continue
+		}
+		key, ok := root.Keys[s.KeyID]
+		if !ok || key.KeyType != "ed25519" {
+			continue
+		}
+		pub, err := hex.DecodeString(key.KeyVal.Public)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		sig, err := decodeSignature(s.Sig)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(pub), env.Signed, sig) {
+			verified[s.KeyID] = true
+		}
+	}
+	if len(verified) < r.Threshold {
+		return fmt.Errorf("%w: %s 角色需要 %d 个有效签名，实际为 %d 个", ErrTUFSignature, role, r.Threshold, len(verified))
+	}
+	return nil
+}
+
+// decodeSignature 签名支持 hex 和 base64 编码
+func decodeSignature(s string) ([]byte, error) {
+	if sig, err := hex.DecodeString(s); err == nil && len(sig) == ed25519.SignatureSize {
+		return sig, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// checkTUFMetaFile 按 timestamp 或 snapshot 中记录的长度和 SHA-256 检查元数据文件
+func checkTUFMetaFile(name string, meta TUFMetaFile, data []byte) error {
+	if meta.Length > 0 && int64(len(data)) != meta.Length {
+		return fmt.Errorf("%s 的长度应为 %d，实际为 %d", name, meta.Length, len(data))
+	}
+	if want, ok := meta.Hashes["sha256"]; ok {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), want) {
+			return fmt.Errorf("%s 的 SHA-256 不一致", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTUFRepo 使用同一个密钥签名全部角色的 TUF 仓库，通过 httptest 提供元数据
+type testTUFRepo struct {
+	t     *testing.T
+	priv  ed25519.PrivateKey
+	keyID string
+
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newTestTUFRepo(t *testing.T) *testTUFRepo {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testTUFRepo{t: t, priv: priv, keyID: KeyID(pub), files: map[string][]byte{}}
+}
+
+func (r *testTUFRepo) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	data, ok := r.files[strings.TrimPrefix(req.URL.Path, "/")]
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Write(data)
+}
+
+// sign 签名元数据并返回元数据文件内容
+func (r *testTUFRepo) sign(signed interface{}) []byte {
+	r.t.Helper()
+	raw, err := json.Marshal(signed)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	data, err := json.Marshal(TUFEnvelope{
+		Signed: raw,
+		Signatures: []ManifestSignature{{
+			KeyID: r.keyID,
+			Sig:   base64.StdEncoding.EncodeToString(ed25519.Sign(r.priv, raw)),
+		}},
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return data
+}
+
+func (r *testTUFRepo) root(expires time.Time) []byte {
+	root := TUFRoot{
+		TUFHeader: TUFHeader{Type: TUF_ROLE_ROOT, Version: 1, Expires: expires},
+		Keys:      map[string]TUFKey{},
+		Roles:     map[string]TUFRole{},
+	}
+	var key TUFKey
+	key.KeyType = "ed25519"
+	key.KeyVal.Public = hex.EncodeToString(r.priv.Public().(ed25519.PublicKey))
+	root.Keys[r.keyID] = key
+	for _, role := range []string{TUF_ROLE_ROOT, TUF_ROLE_TIMESTAMP, TUF_ROLE_SNAPSHOT, TUF_ROLE_TARGETS} {
+		root.Roles[role] = TUFRole{KeyIDs: []string{r.keyID}, Threshold: 1}
+	}
+	return r.sign(root)
+}
+
+// publish 发布版本号为 version 的 timestamp、snapshot 和 targets，timestamp 在 expires 时过期
+func (r *testTUFRepo) publish(version int64, release string, expires time.Time) {
+	later := time.Now().Add(24 * time.Hour)
+	targets := r.sign(TUFTargets{
+		TUFHeader: TUFHeader{Type: TUF_ROLE_TARGETS, Version: version, Expires: later},
+		Custom:    r.versionInfo(release),
+	})
+	snapshot := r.sign(TUFSnapshot{
+		TUFHeader: TUFHeader{Type: TUF_ROLE_SNAPSHOT, Version: version, Expires: later},
+		Meta:      map[string]TUFMetaFile{"targets.json": {Version: version}},
+	})
+	sum := sha256.Sum256(snapshot)
+	timestamp := r.sign(TUFTimestamp{
+		TUFHeader: TUFHeader{Type: TUF_ROLE_TIMESTAMP, Version: version, Expires: expires},
+		Meta: map[string]TUFMetaFile{"snapshot.json": {
+			Version: version,
+			Length:  int64(len(snapshot)),
+			Hashes:  map[string]string{"sha256": hex.EncodeToString(sum[:])},
+		}},
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files["targets.json"] = targets
+	r.files["snapshot.json"] = snapshot
+	r.files["timestamp.json"] = timestamp
+}
+
+// versionInfo 返回放在 targets 中的版本信息，包含当前平台的制品
+func (r *testTUFRepo) versionInfo(release string) json.RawMessage {
+	r.t.Helper()
+	data, err := json.Marshal(VersionInfo{
+		Version: release,
+		Artifacts: map[string]Artifact{
+			CurrentPlatform().String(): {URL: "https://example.com/allinone-" + release, SHA256: strings.Repeat("0", 64)},
+		},
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return data
+}
+
+// newTUFTestUpdater 创建从 repo 获取 TUF 元数据的更新器，初始 root 在 rootExpires 时过期
+func newTUFTestUpdater(t *testing.T, repo *testTUFRepo, rootExpires time.Time) *Updater {
+	t.Helper()
+	srv := httptest.NewServer(repo)
+	t.Cleanup(srv.Close)
+
+	u := newTestUpdater(t, func(cfg *Config) {
+		cfg.TUFMetadataUrl = srv.URL
+		cfg.TUFRootFile = "root.json"
+	})
+	if err := os.WriteFile(u.path("root.json"), repo.root(rootExpires), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestTUFUpdate(t *testing.T) {
+	repo := newTestTUFRepo(t)
+	repo.publish(1, "1.2.0", time.Now().Add(time.Hour))
+	u := newTUFTestUpdater(t, repo, time.Now().Add(365*24*time.Hour))
+
+	info, err := u.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.2.0" || info.DownloadUrl != "https://example.com/allinone-1.2.0" {
+		t.Fatalf("版本信息应来自 targets，实际为 %s %s", info.Version, info.DownloadUrl)
+	}
+	for _, name := range []string{"root.json", "timestamp.json", "snapshot.json", "targets.json"} {
+		if _, err := os.Stat(filepath.Join(u.path(u.cfg.TUFMetadataDir), name)); err != nil {
+			t.Errorf("应保存已信任的 %s: %v", name, err)
+		}
+	}
+}
+
+func TestTUFRejectsRollback(t *testing.T) {
+	repo := newTestTUFRepo(t)
+	repo.publish(2, "1.3.0", time.Now().Add(time.Hour))
+	u := newTUFTestUpdater(t, repo, time.Now().Add(365*24*time.Hour))
+	if _, err := u.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 签名有效但版本号更低的旧元数据
+	repo.publish(1, "1.2.0", time.Now().Add(time.Hour))
+	_, err := u.Check()
+	if !errors.Is(err, ErrTUFRollback) {
+		t.Fatalf("应拒绝回滚的元数据，实际错误: %v", err)
+	}
+}
+
+func TestTUFRejectsExpiredMetadata(t *testing.T) {
+	repo := newTestTUFRepo(t)
+	repo.publish(1, "1.2.0", time.Now().Add(-time.Minute))
+	u := newTUFTestUpdater(t, repo, time.Now().Add(365*24*time.Hour))
+
+	_, err := u.Check()
+	if !errors.Is(err, ErrTUFExpired) {
+		t.Fatalf("应拒绝过期的 timestamp，实际错误: %v", err)
+	}
+}
+
+func TestTUFRejectsExpiredRoot(t *testing.T) {
+	repo := newTestTUFRepo(t)
+	repo.publish(1, "1.2.0", time.Now().Add(time.Hour))
+	u := newTUFTestUpdater(t, repo, time.Now().Add(-time.Minute))
+
+	_, err := u.Check()
+	if !errors.Is(err, ErrTUFExpired) || !strings.Contains(err.Error(), TUF_ROLE_ROOT) {
+		t.Fatalf("应拒绝过期的 root，实际错误: %v", err)
+	}
+}
+
+func TestTUFRejectsUntrustedSignature(t *testing.T) {
+	repo := newTestTUFRepo(t)
+	u := newTUFTestUpdater(t, repo, time.Now().Add(365*24*time.Hour))
+
+	// 用另一个密钥签名，但声称是 root 中的公钥
+	other := newTestTUFRepo(t)
+	other.keyID = repo.keyID
+	other.publish(1, "9.9.9", time.Now().Add(time.Hour))
+	repo.mu.Lock()
+	repo.files = other.files
+	repo.mu.Unlock()
+
+	_, err := u.Check()
+	if !errors.Is(err, ErrTUFSignature) {
+		t.Fatalf("应拒绝签名无效的元数据，实际错误: %v", err)
+	}
+}
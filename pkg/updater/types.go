@@ -4,21 +4,39 @@ package updater
 type VersionInfo struct {
 	Version     string `json:"version"`
 	DownloadUrl string `json:"downloadUrl"`
-	Amd64       string `json:"amd64"`
-	Arm64       string `json:"arm64"`
-	Arm         string `json:"arm"`
-	Darwin      string `json:"darwin"`
-}
+	// Rollback 允许安装低于本地的版本，用于服务器主动回滚
+	Rollback bool `json:"rollback,omitempty"`
+	// Critical 紧急版本，跳过灰度立即安装
+	Critical bool `json:"critical,omitempty"`
+	// MinVersion 最低版本，本地版本低于它时跳过灰度立即更新
+	MinVersion string `json:"min_version,omitempty"`
+	// BlockedVersions 禁止安装的版本，本地正在运行这些版本时回滚到远程版本
+	BlockedVersions []string `json:"blocked_versions,omitempty"`
+	// Rollout 灰度发布设置，为空时所有设备都安装
+	Rollout *Rollout `json:"rollout,omitempty"`
+	// Artifacts 按 os/arch[/variant] 索引的制品，如 linux/arm/v7、darwin/arm64
+	Artifacts map[string]Artifact `json:"artifacts,omitempty"`
+	// Files 与可执行文件一起安装的附加文件，如网页资源和默认配置
+	Files []BundleFile `json:"files,omitempty"`
+	// Channels 按发布频道划分的最新版本，如 stable、beta、nightly
+	Channels map[string]VersionInfo `json:"channels,omitempty"`
+
+	// 旧版本信息的固定平台字段，artifacts 中没有匹配的平台时使用
+	Amd64  Artifact `json:"amd64"`
+	Arm64  Artifact `json:"arm64"`
+	Arm    Artifact `json:"arm"`
+	Darwin Artifact `json:"darwin"`
 
-// RequestHeaders 请求头结构体
-type RequestHeaders struct {
-	Timestamp string
-	Sign      string
-	UserAgent string
+	// Artifact 当前平台的制品，由 Check 填入
+	Artifact Artifact `json:"-"`
 }
 
 // Headers 请求头结构体
 type Headers struct {
-	Timestamp string
-	Sign      string
+	Version     int
+	KeyID       string
+	Timestamp   string
+	Nonce       string
+	ContentHash string
+	Sign        string
 }
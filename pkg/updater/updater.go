@@ -9,69 +9,271 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
+	"reflect"
+	"sync"
 	"time"
 )
 
-// StartUpdateChecker 启动更新检查器
-func StartUpdateChecker() error {
-	ticker := time.NewTicker(CHECK_INTERVAL)
-	for range ticker.C {
-		if err := CheckAndUpdate(); err != nil {
-			Logf("定时更新检查失败: %v", err)
-		}
+// Updater 自动更新器，持有一次部署所需的全部状态，同一进程内可以创建多个实例
+type Updater struct {
+	// cfgMu 保护 cfg 的写入以及 Run 以外的 goroutine 对 cfg 的读取
+	cfgMu   sync.RWMutex
+	cfg     Config
+	workDir string
+	log     *LogManager
+
+	// keys 和 manifestKeys 为配置中的密钥与本地保存的轮换密钥合并后的密钥环
+	keys         []secretKey
+	manifestKeys []manifestKey
+
+	stateMu sync.Mutex
+	state   State
+
+	// customSource 通过 WithSource 指定的更新源，为空时按配置创建
+	customSource Source
+
+	reloadMu sync.Mutex
+	reloadCh chan Config
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// Option 创建 Updater 时的可选项
+type Option func(*Updater)
+
+// WithWorkDir 设置工作目录，配置中程序文件、版本文件和日志目录等相对路径都基于该目录解析
+func WithWorkDir(dir string) Option {
+	return func(u *Updater) {
+		u.workDir = dir
 	}
-	return nil
 }
 
-// CheckAndUpdate 检查并更新程序
-func CheckAndUpdate() error {
-	Logf("开始检查更新...")
+// WithLogger 使用指定的日志管理器，默认写入工作目录下的日志目录
+func WithLogger(lm *LogManager) Option {
+	return func(u *Updater) {
+		u.log = lm
+	}
+}
 
-	// 获取远程版本信息
-	versionInfo, err := getRemoteVersion()
+// New 创建更新器
+func New(cfg Config, opts ...Option) (*Updater, error) {
+	u := &Updater{
+		cfg:      cfg,
+		reloadCh: make(chan Config, 1),
+		stopCh:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("配置无效: %w", err)
+	}
+
+	if u.log == nil {
+		u.log = NewLogManager(u.path(cfg.LogDir))
+	}
+
+	keys, manifestKeys, err := u.loadKeyRings(cfg)
 	if err != nil {
-		return fmt.Errorf("获取远程版本失败: %v", err)
+		return nil, fmt.Errorf("配置无效: %w", err)
 	}
+	u.keys, u.manifestKeys = keys, manifestKeys
 
-	// 获取当前平台下载链接
-	downloadUrl := getPlatformDownloadUrl(versionInfo)
-	if downloadUrl == "" {
-		return fmt.Errorf("没有适合当前平台的下载链接")
+	if len(manifestKeys) == 0 && cfg.AllowUnsignedManifest {
+		u.logf("警告: 已设置 allow_unsigned_manifest，接受未签名的版本信息，能够访问更新源或拿到设备上 secret_key 的人都可以发布版本")
+	}
+	if len(cfg.ArtifactPublicKeys) == 0 && cfg.AllowUnsignedArtifacts {
+		u.logf("警告: 已设置 allow_unsigned_artifacts，制品只校验 SHA-256 摘要，不校验签名")
 	}
 
-	// 检查版本并更新
-	return updateIfNeeded(versionInfo, downloadUrl)
+	state, err := u.loadState()
+	if err != nil {
+		u.logf("%v，使用空状态", err)
+	}
+	u.state = state
+	if state.ClockOffset != 0 {
+		u.log.SetClockOffset(time.Duration(state.ClockOffset))
+		u.logf("使用保存的时间偏移: %s", time.Duration(state.ClockOffset))
+	}
+
+	return u, nil
 }
 
-// getRemoteVersion 获取远程版本信息
-func getRemoteVersion() (*VersionInfo, error) {
-	headers, err := GenerateHeaders()
+// Config 返回当前生效的配置
+func (u *Updater) Config() Config {
+	u.cfgMu.RLock()
+	defer u.cfgMu.RUnlock()
+	return u.cfg
+}
+
+// Reload 校验并提交新配置，在 Run 循环中当前检查结束后生效，不会重启被管理的服务。
+// 在 Run 启动前提交的配置会在 Run 开始时生效
+func (u *Updater) Reload(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("配置无效: %w", err)
+	}
+
+	u.reloadMu.Lock()
+	defer u.reloadMu.Unlock()
+	// 丢弃尚未生效的旧配置，只保留最新的一份
+	select {
+	case <-u.reloadCh:
+	default:
+	}
+	u.reloadCh <- cfg
+	return nil
+}
+
+// applyConfig 应用新配置并记录变更的配置项
+func (u *Updater) applyConfig(cfg Config) {
+	// 密钥文件或环境变量的内容可能在配置项不变的情况下被修改，每次都重新读取
+	keys, manifestKeys, err := u.loadKeyRings(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("生成请求头失败: %v", err)
+		u.logf("读取密钥失败，继续使用当前配置: %v", err)
+		return
+	}
+
+	changes := diffConfig(u.cfg, cfg)
+	if !reflect.DeepEqual(keys, u.keys) && len(changes) == 0 {
+		changes = append(changes, "密钥内容已修改")
+	}
+	if len(changes) == 0 {
+		u.logf("配置已重新加载，没有变化")
+		return
+	}
+
+	if cfg.LogDir != u.cfg.LogDir {
+		u.logf("log_dir 的修改需要重启后生效")
+	}
+
+	u.cfgMu.Lock()
+	u.cfg = cfg
+	u.keys, u.manifestKeys = keys, manifestKeys
+	u.cfgMu.Unlock()
+
+	for _, change := range changes {
+		u.logf("配置变更: %s", change)
+	}
+}
+
+// Logger 返回更新器使用的日志管理器
+func (u *Updater) Logger() *LogManager {
+	return u.log
+}
+
+// logf 写入一条日志
+func (u *Updater) logf(format string, v ...interface{}) {
+	u.log.output(3, fmt.Sprintf(format, v...))
+}
+
+// path 将相对路径解析到工作目录下
+func (u *Updater) path(name string) string {
+	if u.workDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(u.workDir, name)
+}
+
+// Run 立即检查一次更新，之后定时检查，直到调用 Stop。通过 Reload 提交的配置在两次检查之间生效
+func (u *Updater) Run() error {
+	select {
+	case cfg := <-u.reloadCh:
+		u.applyConfig(cfg)
+	default:
+	}
+
+	// 首次运行立即检查
+	if err := u.CheckAndUpdate(); err != nil {
+		u.logf("首次更新检查失败: %v", err)
+	}
+
+	interval := time.Duration(u.cfg.CheckInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.stopCh:
+			u.logf("更新检查器已停止")
+			return nil
+		case cfg := <-u.reloadCh:
+			u.applyConfig(cfg)
+			if d := time.Duration(u.cfg.CheckInterval); d != interval {
+				interval = d
+				ticker.Reset(interval)
+				u.logf("检查间隔已调整为 %s", interval)
+			}
+		case <-ticker.C:
+			if err := u.CheckAndUpdate(); err != nil {
+				u.logf("定时更新检查失败: %v", err)
+			}
+		}
 	}
+}
+
+// Stop 停止 Run 中的定时检查，不影响已启动的服务进程
+func (u *Updater) Stop() {
+	u.stopOnce.Do(func() {
+		close(u.stopCh)
+	})
+}
 
-	req, err := http.NewRequest("GET", API_URL, nil)
+// CheckAndUpdate 检查并更新程序
+func (u *Updater) CheckAndUpdate() error {
+	versionInfo, err := u.Check()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req.Header.Set("X-Timestamp", headers.Timestamp)
-	req.Header.Set("X-Sign", headers.Sign)
-	req.Header.Set("User-Agent", "MyTV/1.0")
+	// 检查版本并更新
+	return u.Update(versionInfo)
+}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// Check 获取远程版本信息，并将当前平台的制品及其下载链接填入 Artifact 和 DownloadUrl
+func (u *Updater) Check() (*VersionInfo, error) {
+	u.reloadState()
+	channel := u.Channel()
+	u.logf("开始检查更新，发布频道: %s", channel)
+
+	// 获取远程版本信息
+	src, err := u.source()
+	if err != nil {
+		return nil, err
+	}
+	versionInfo, err := src.Latest()
+	if err != nil {
+		return nil, fmt.Errorf("获取远程版本失败: %w", err)
 	}
-	resp, err := client.Do(req)
+	versionInfo, err = u.selectChannel(versionInfo, channel)
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
+		return nil, err
+	}
+
+	// 获取当前平台下载链接
+	artifact := u.getPlatformArtifact(versionInfo)
+	if artifact.URL == "" {
+		return nil, fmt.Errorf("没有适合当前平台的下载链接")
+	}
+	versionInfo.Artifact = artifact
+	versionInfo.DownloadUrl = artifact.URL
+
+	return versionInfo, nil
+}
+
+// getRemoteVersion 获取远程版本信息
+func (u *Updater) getRemoteVersion() (*VersionInfo, error) {
+	if u.cfg.TUFMetadataUrl != "" {
+		return u.getTUFVersion()
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	apiUrl, err := channelURL(u.cfg.ApiUrl, u.Channel())
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %v", err)
+		return nil, err
+	}
+	resp, body, err := u.doSignedRequest("GET", apiUrl, nil, u.manifestHeader())
+	if err != nil {
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -84,27 +286,40 @@ func getRemoteVersion() (*VersionInfo, error) {
 		return nil, fmt.Errorf("Base64解码失败: %v", err)
 	}
 
-	decryptedData, err := decryptAESCBC(decodedData)
+	decryptedData, err := decryptManifest(u.decryptionKeys(resp.Header.Get("X-Key-Id")), decodedData, u.cfg.AllowCBC)
 	if err != nil {
 		return nil, fmt.Errorf("解密失败: %v", err)
 	}
 
+	// 在使用任何字段之前校验签名
+	manifest, err := u.verifyManifest(decryptedData)
+	if err != nil {
+		return nil, err
+	}
+
 	var versionInfo VersionInfo
-	if err := json.Unmarshal(decryptedData, &versionInfo); err != nil {
+	if err := json.Unmarshal(manifest, &versionInfo); err != nil {
 		return nil, fmt.Errorf("解析版本信息失败: %v", err)
 	}
 
 	return &versionInfo, nil
 }
 
-// getPlatformDownloadUrl 获取当前平台的下载链接
-func getPlatformDownloadUrl(versionInfo *VersionInfo) string {
-	os := runtime.GOOS
-	arch := runtime.GOARCH
+// getPlatformArtifact 获取当前平台的制品，优先使用 artifacts 中最具体的匹配，
+// 没有匹配时回退到旧的固定平台字段
+func (u *Updater) getPlatformArtifact(versionInfo *VersionInfo) Artifact {
+	platform := CurrentPlatform()
+	u.logf("当前平台: %s", platform)
+	for _, key := range platform.Keys() {
+		if a, ok := versionInfo.Artifacts[key]; ok && a.URL != "" {
+			u.logf("使用平台 %s 的制品", key)
+			return a
+		}
+	}
 
-	switch os {
+	switch platform.OS {
 	case "linux":
-		switch arch {
+		switch platform.Arch {
 		case "amd64":
 			return versionInfo.Amd64
 		case "arm64":
@@ -116,47 +331,139 @@ func getPlatformDownloadUrl(versionInfo *VersionInfo) string {
 		return versionInfo.Darwin
 	}
 
-	Logf("不支持的平台: %s/%s", os, arch)
-	return ""
+	u.logf("不支持的平台: %s", platform)
+	return Artifact{}
 }
 
-// updateIfNeeded 在需要时更新程序
-func updateIfNeeded(versionInfo *VersionInfo, downloadUrl string) error {
-	localVersion, err := readLocalVersion()
-	needUpdate := err != nil || localVersion != versionInfo.Version
+// Update 在远程版本高于本地版本时下载并运行新版本，否则检查服务状态
+func (u *Updater) Update(versionInfo *VersionInfo) error {
+	localVersion, err := u.readLocalVersion()
+	needUpdate, err := u.needUpdate(localVersion, err, versionInfo)
+	if err != nil {
+		return err
+	}
 
 	if needUpdate {
 		// 需要更新时的逻辑
-		versionInfo.DownloadUrl = downloadUrl
-		if err := downloadAndRun(versionInfo); err != nil {
+		if err := u.downloadAndRun(versionInfo); err != nil {
 			return fmt.Errorf("更新失败: %v", err)
 		}
-		if err := saveLocalVersion(versionInfo.Version); err != nil {
+		if err := u.saveLocalVersion(versionInfo.Version); err != nil {
 			return fmt.Errorf("保存版本信息失败: %v", err)
 		}
-		Logf("更新成功，新版本: %s", versionInfo.Version)
+		u.logf("更新成功，新版本: %s", versionInfo.Version)
+		u.finishChannelSwitch()
 	} else {
+		u.finishChannelSwitch()
 		// 不需要更新时，检查端口状态
-		Logf("当前版本已是最新: %s，检查服务状态", localVersion)
+		u.logf("当前版本: %s，检查服务状态", localVersion)
 		// 使用新的封装函数
-		waitWithCountdown(90, "开始等待90秒...")
+		wait := time.Duration(u.cfg.ServiceCheckWait)
+		u.waitWithCountdown(wait, fmt.Sprintf("开始等待%s...", wait))
 		// 检查端口是否在监听
-		if !isPortInUse(35455) {
-			Logf("端口 35455 未被监听，启动服务")
-			if err := ensureServiceRunning(); err != nil {
+		if !isPortInUse(u.cfg.ServicePort) {
+			u.logf("端口 %d 未被监听，启动服务", u.cfg.ServicePort)
+			if err := u.ensureServiceRunning(); err != nil {
 				return fmt.Errorf("启动服务失败: %v", err)
 			}
 		} else {
-			Logf("服务正在运行，端口 35455 正常监听中")
+			u.logf("服务正在运行，端口 %d 正常监听中", u.cfg.ServicePort)
 		}
 	}
 
 	return nil
 }
 
+// needUpdate 按语义化版本判断是否需要更新。禁止安装的远程版本不会安装；
+// 只更新到更高的版本，且设备需在该版本的灰度范围内，紧急版本和低于最低版本时跳过灰度；
+// 低于本地的版本只有在版本信息标记为 rollback、设置了 allow_downgrade、刚切换了频道
+// 或本地版本被禁止时才会安装
+func (u *Updater) needUpdate(localVersion string, readErr error, info *VersionInfo) (bool, error) {
+	remote, err := ParseVersion(info.Version)
+	if err != nil {
+		return false, fmt.Errorf("远程版本号无效: %v", err)
+	}
+	if u.isBlocked(info, remote) {
+		u.logf("远程版本 %s 已被禁止安装", remote)
+		return false, nil
+	}
+	if readErr != nil {
+		u.logf("读取本地版本失败: %v，安装远程版本 %s", readErr, remote)
+		return true, nil
+	}
+	local, err := ParseVersion(localVersion)
+	if err != nil {
+		u.logf("本地版本号无效: %v，安装远程版本 %s", err, remote)
+		return true, nil
+	}
+	localBlocked := u.isBlocked(info, local)
+
+	switch c := remote.Compare(local); {
+	case c > 0:
+		u.logf("发现新版本: %s -> %s", local, remote)
+		switch {
+		case info.Critical:
+			u.logf("版本 %s 为紧急版本，立即更新", remote)
+			return true, nil
+		case localBlocked:
+			u.logf("本地版本 %s 已被禁止，立即更新", local)
+			return true, nil
+		case u.belowMinVersion(info, local):
+			u.logf("本地版本 %s 低于最低版本 %s，立即更新", local, info.MinVersion)
+			return true, nil
+		}
+		return u.inRollout(info), nil
+	case c == 0:
+		return false, nil
+	case info.Rollback:
+		u.logf("版本信息标记为回滚，降级: %s -> %s", local, remote)
+		return true, nil
+	case localBlocked:
+		u.logf("本地版本 %s 已被禁止，回滚: %s -> %s", local, local, remote)
+		return true, nil
+	case u.cfg.AllowDowngrade:
+		u.logf("已设置 allow_downgrade，降级: %s -> %s", local, remote)
+		return true, nil
+	case u.channelSwitchPending():
+		u.logf("已切换到 %s 频道，降级: %s -> %s", u.Channel(), local, remote)
+		return true, nil
+	}
+	u.logf("远程版本 %s 低于本地版本 %s，拒绝降级", remote, local)
+	return false, nil
+}
+
+// isBlocked 判断版本是否在版本信息的 blocked_versions 中，忽略无效的版本号
+func (u *Updater) isBlocked(info *VersionInfo, v SemVer) bool {
+	for _, s := range info.BlockedVersions {
+		blocked, err := ParseVersion(s)
+		if err != nil {
+			u.logf("忽略无效的禁止版本 %q: %v", s, err)
+			continue
+		}
+		if v.Compare(blocked) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// belowMinVersion 判断版本是否低于版本信息的 min_version，min_version 无效时忽略
+func (u *Updater) belowMinVersion(info *VersionInfo, v SemVer) bool {
+	if info.MinVersion == "" {
+		return false
+	}
+	minVersion, err := ParseVersion(info.MinVersion)
+	if err != nil {
+		u.logf("忽略无效的最低版本 %q: %v", info.MinVersion, err)
+		return false
+	}
+	return v.Compare(minVersion) < 0
+}
+
 // waitWithCountdown 带倒计时的等待函数
-func waitWithCountdown(seconds int, message string) {
-	Logf(message)
+func (u *Updater) waitWithCountdown(wait time.Duration, message string) {
+	seconds := int(wait / time.Second)
+	u.logf(message)
 	startTime := time.Now()
 	for i := seconds; i > 0; i-- {
 		elapsed := time.Since(startTime).Seconds()
@@ -164,13 +471,13 @@ func waitWithCountdown(seconds int, message string) {
 		time.Sleep(1 * time.Second)
 	}
 	fmt.Println() // 换行
-	Logf("等待%d秒结束", seconds)
+	u.logf("等待%s结束", wait)
 }
 
 // 新增：确保服务运行的函数
-func ensureServiceRunning() error {
+func (u *Updater) ensureServiceRunning() error {
 	// 获取本地文件的绝对路径
-	absPath, err := filepath.Abs(LOCAL_FILE)
+	absPath, err := filepath.Abs(u.path(u.cfg.LocalFile))
 	if err != nil {
 		return fmt.Errorf("获取本地文件路径失败: %v", err)
 	}
@@ -184,18 +491,20 @@ func ensureServiceRunning() error {
 	if err := os.Chmod(absPath, 0755); err != nil {
 		return fmt.Errorf("设置执行权限失败: %v", err)
 	}
-	waitWithCountdown(20, "等待20秒，确保端口 35455 的占用进程关闭")
-	Logf("尝试关闭端口 35455 的占用进程,确保端口可用")
-	if err := stopProcessByPort(35455); err != nil {
-		return fmt.Errorf("端口 35455 被占用且无法关闭: %v", err)
+	port := u.cfg.ServicePort
+	wait := time.Duration(u.cfg.PortReleaseWait)
+	u.waitWithCountdown(wait, fmt.Sprintf("等待%s，确保端口 %d 的占用进程关闭", wait, port))
+	u.logf("尝试关闭端口 %d 的占用进程,确保端口可用", port)
+	if err := u.stopProcessByPort(port); err != nil {
+		return fmt.Errorf("端口 %d 被占用且无法关闭: %v", port, err)
 	}
 
 	// 创建完成信号通道
 	done := make(chan error)
 
 	go func() {
-		Logf("开始执行本地文件: %s", absPath)
-		if err := executeNewFile(absPath); err != nil {
+		u.logf("开始执行本地文件: %s", absPath)
+		if err := u.executeNewFile(absPath); err != nil {
 			done <- fmt.Errorf("执行本地文件失败: %v", err)
 			return
 		}
@@ -206,7 +515,7 @@ func ensureServiceRunning() error {
 			return
 		}
 
-		Logf("执行成功, 监听 %s:35455", ip)
+		u.logf("执行成功, 监听 %s:%d", ip, u.cfg.ServicePort)
 		done <- nil
 	}()
 
@@ -224,62 +533,65 @@ func ensureServiceRunning() error {
 }
 
 // downloadAndRun 下载并运行新版本
-func downloadAndRun(info *VersionInfo) error {
+func (u *Updater) downloadAndRun(info *VersionInfo) error {
 	// 首先检查端口
-	if isPortInUse(35455) {
-		Logf("端口 35455 已被占用，尝试关闭占用进程...")
-		if err := stopProcessByPort(35455); err != nil {
+	port := u.cfg.ServicePort
+	if isPortInUse(port) {
+		u.logf("端口 %d 已被占用，尝试关闭占用进程...", port)
+		if err := u.stopProcessByPort(port); err != nil {
 			return fmt.Errorf("无法关闭占用端口的进程: %v", err)
 		}
 	}
 
-	Logf("开始下载文件...")
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-		Transport: &http.Transport{
-			TLSHandshakeTimeout:   15 * time.Second,
-			ResponseHeaderTimeout: 15 * time.Second,
-			DisableKeepAlives:     true,
-			Proxy:                 http.ProxyFromEnvironment,
-		},
-	}
-
-	// 先尝试使用代理下载
-	proxyURL := "https://ghp.ci/" + info.DownloadUrl
-	if err := tryDownload(client, proxyURL); err != nil {
-		Logf("代理下载失败: %v，尝试直接下载", err)
-		// 代理失败后尝试直接下载
-		if err := tryDownload(client, info.DownloadUrl); err != nil {
-			return fmt.Errorf("所有下载方式均失败: %v", err)
+	u.logf("开始下载文件...")
+	src, err := u.source()
+	if err != nil {
+		return err
+	}
+
+	artifact := info.Artifact
+	if artifact.URL == "" {
+		artifact.URL = info.DownloadUrl
+	}
+
+	// 有适用的差分补丁时先尝试补丁，失败时下载完整制品
+	tmpFile := u.fetchPatched(src, artifact, info)
+	if tmpFile == "" {
+		if tmpFile, err = u.fetchArtifact(src, artifact); err != nil {
+			return err
 		}
 	}
+	defer os.Remove(tmpFile)
 
-	Logf("下载完成")
+	u.logf("下载完成")
+	if err := u.install(src, tmpFile, artifact, info); err != nil {
+		return err
+	}
 
 	// 添加执行权限
-	if err := os.Chmod(LOCAL_FILE, 0755); err != nil {
+	if err := os.Chmod(u.path(u.cfg.LocalFile), 0755); err != nil {
 		return fmt.Errorf("设置执行权限失败: %v", err)
 	}
-	Logf("已设置执行权限")
+	u.logf("已设置执行权限")
 
 	// 创建一个完成信号通道
 	done := make(chan error)
 
 	go func() {
-		if err := StopProcessByName(); err != nil {
+		if err := u.StopProcessByName(); err != nil {
 			done <- fmt.Errorf("停止旧进程失败: %v", err)
 			return
 		}
 
 		// 获取文件的绝对路径
-		absPath, err := filepath.Abs(LOCAL_FILE)
+		absPath, err := filepath.Abs(u.path(u.cfg.LocalFile))
 		if err != nil {
 			done <- fmt.Errorf("获取文件绝对路径失败: %v", err)
 			return
 		}
 
-		Logf("开始执行新文件: %s", absPath)
-		if err := executeNewFile(absPath); err != nil {
+		u.logf("开始执行新文件: %s", absPath)
+		if err := u.executeNewFile(absPath); err != nil {
 			done <- fmt.Errorf("执行新文件失败: %v", err)
 			return
 		}
@@ -290,7 +602,7 @@ func downloadAndRun(info *VersionInfo) error {
 			return
 		}
 
-		Logf("执行成功, 监听 %s:35455", ip)
+		u.logf("执行成功, 监听 %s:%d", ip, u.cfg.ServicePort)
 		done <- nil
 	}()
 
@@ -311,8 +623,8 @@ func downloadAndRun(info *VersionInfo) error {
 }
 
 // readLocalVersion 读取本地版本号
-func readLocalVersion() (string, error) {
-	data, err := os.ReadFile(VERSION_FILE)
+func (u *Updater) readLocalVersion() (string, error) {
+	data, err := os.ReadFile(u.path(u.cfg.VersionFile))
 	if err != nil {
 		return "", err
 	}
@@ -320,56 +632,134 @@ func readLocalVersion() (string, error) {
 }
 
 // saveLocalVersion 保存本地版本号
-func saveLocalVersion(version string) error {
-	return os.WriteFile(VERSION_FILE, []byte(version), 0644)
+func (u *Updater) saveLocalVersion(version string) error {
+	return os.WriteFile(u.path(u.cfg.VersionFile), []byte(version), 0644)
+}
+
+// fetchArtifact 按线路得分依次尝试各镜像和代理前缀下载制品，返回校验通过的临时文件
+func (u *Updater) fetchArtifact(src Source, artifact Artifact) (string, error) {
+	if artifact.SHA256 == "" {
+		return "", fmt.Errorf("%w: 制品没有提供 SHA-256 摘要，拒绝下载", ErrArtifactMismatch)
+	}
+	var lastErr error
+	for _, c := range u.downloadCandidates(artifact) {
+		result, err := u.tryDownload(src, c.url, artifact)
+		u.recordDownload(c, result, err)
+		if err != nil {
+			u.logf("从 %s 下载失败: %v", c.url, err)
+			lastErr = err
+			continue
+		}
+		u.logf("使用线路 %s 下载 %d 字节，用时 %s，速度 %s", c.key, result.size,
+			result.elapsed.Round(time.Millisecond), formatThroughput(result.throughput()))
+		return result.file, nil
+	}
+	if lastErr == nil {
+		return "", fmt.Errorf("没有可用的下载地址")
+	}
+	return "", fmt.Errorf("所有下载方式均失败: %w", lastErr)
+}
+
+// downloadResult 一次下载的耗时和大小
+type downloadResult struct {
+	// latency 收到响应头所用时间
+	latency time.Duration
+	// elapsed 从发出请求到写完文件所用时间
+	elapsed time.Duration
+	size    int64
+	// file 校验通过的临时文件，由调用方安装后删除
+	file string
 }
 
-// tryDownload 处理下载逻辑
-func tryDownload(client *http.Client, url string) error {
-	Logf("尝试从 %s 下载", url)
+// tryDownload 下载到临时文件并校验制品的大小、摘要和签名。
+// 校验失败的文件保留为 <local_file>.rejected 供检查，只保留最近一次
+func (u *Updater) tryDownload(src Source, url string, artifact Artifact) (downloadResult, error) {
+	var result downloadResult
+	u.logf("尝试从 %s 下载", url)
 
-	resp, err := client.Get(url)
+	keys, err := parseMinisignPublicKeys(u.cfg.ArtifactPublicKeys)
 	if err != nil {
-		return fmt.Errorf("HTTP请求失败: %v", err)
+		return result, err
+	}
+	if artifact.verifiedLater && artifact.Signature == "" {
+		keys = nil
+	}
+	verifier, err := newArtifactVerifier(artifact, keys)
+	if err != nil {
+		return result, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP状态码错误: %d", resp.StatusCode)
+	start := time.Now()
+	body, err := src.Fetch(url)
+	result.latency = time.Since(start)
+	if err != nil {
+		return result, err
 	}
+	defer body.Close()
 
-	// 创建临时文件
-	tmpFile := LOCAL_FILE + ".tmp"
-	out, err := os.Create(tmpFile)
+	// 创建临时文件，每次下载使用不同的文件名
+	localFile := u.path(u.cfg.LocalFile)
+	out, err := os.CreateTemp(filepath.Dir(localFile), filepath.Base(localFile)+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("创建临时文件失败: %v", err)
+		return result, fmt.Errorf("创建临时文件失败: %v", err)
 	}
+	tmpFile := out.Name()
+	keep := false
 	defer func() {
 		out.Close()
-		os.Remove(tmpFile) // 清理临时文件
+		if !keep {
+			os.Remove(tmpFile) // 清理临时文件
+		}
 	}()
 
-	// 写入临时文件
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		return fmt.Errorf("写入文件失败: %v", err)
+	// 写入临时文件的同时计算摘要
+	result.size, err = io.Copy(io.MultiWriter(out, verifier), verifier.wrap(body))
+	result.elapsed = time.Since(start)
+	if err != nil {
+		return result, fmt.Errorf("写入文件失败: %v", err)
 	}
 
 	// 确保文件完全写入
 	if err := out.Sync(); err != nil {
-		return fmt.Errorf("同步文件失败: %v", err)
+		return result, fmt.Errorf("同步文件失败: %v", err)
 	}
 	out.Close()
 
+	if err := verifier.verify(tmpFile); err != nil {
+		// 只保留最近一次校验失败的文件，避免每个失败的镜像都留下一个完整大小的文件
+		rejected := localFile + ".rejected"
+		if renameErr := os.Rename(tmpFile, rejected); renameErr == nil {
+			u.logf("制品校验失败，拒绝替换程序文件，已保留文件 %s 供检查", rejected)
+		}
+		return result, err
+	}
+	u.logf("制品校验通过: %d 字节, SHA-256 %x", verifier.written, verifier.sha.Sum(nil))
+
+	keep = true
+	result.file = tmpFile
+	return result, nil
+}
+
+// install 安装校验通过的制品：压缩包或带有附加文件的版本安装到版本目录，
+// 单个可执行文件直接替换程序文件
+func (u *Updater) install(src Source, file string, artifact Artifact, info *VersionInfo) error {
+	format, err := archiveFormat(artifact, file)
+	if err != nil {
+		return err
+	}
+	if format != ARCHIVE_NONE || len(info.Files) > 0 {
+		return u.installRelease(src, file, format, artifact, info)
+	}
+
 	// 在重命名文件之前设置执行权限
-	if err := os.Chmod(tmpFile, 0755); err != nil {
+	if err := os.Chmod(file, 0755); err != nil {
 		return fmt.Errorf("设置文件权限失败: %v", err)
 	}
 
 	// 重命名临时文件为目标文件
-	if err := os.Rename(tmpFile, LOCAL_FILE); err != nil {
+	if err := os.Rename(file, u.path(u.cfg.LocalFile)); err != nil {
 		return fmt.Errorf("重命名文件失败: %v", err)
 	}
-
 	return nil
 }
 
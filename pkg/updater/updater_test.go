@@ -0,0 +1,88 @@
+package updater
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestUpdater 在临时工作目录中创建更新器，configure 在默认配置上修改测试需要的配置项。
+// 默认配置允许未签名的制品，日志写入工作目录下的 logs
+func newTestUpdater(t *testing.T, configure func(cfg *Config)) *Updater {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.AllowUnsignedArtifacts = true
+	if configure != nil {
+		configure(&cfg)
+	}
+	u, err := New(cfg, WithWorkDir(dir), WithLogger(NewLogManager(filepath.Join(dir, "logs"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestNeedUpdate(t *testing.T) {
+	noRollout := &Rollout{Percentage: 0}
+	static := func(cfg *Config) {
+		cfg.Source = SOURCE_STATIC
+		cfg.SourceURL = "https://example.com/manifest.json"
+		cfg.AllowUnsignedManifest = true
+	}
+
+	cases := []struct {
+		name    string
+		local   string
+		readErr error
+		info    VersionInfo
+		// configure 和 channel 在判断前修改配置或切换频道
+		configure func(cfg *Config)
+		channel   string
+		want      bool
+	}{
+		{name: "新版本", local: "1.2.0", info: VersionInfo{Version: "1.3.0"}, want: true},
+		{name: "版本相同", local: "1.2.0", info: VersionInfo{Version: "1.2.0"}, want: false},
+		{name: "读取本地版本失败", readErr: errors.New("not found"), info: VersionInfo{Version: "1.3.0"}, want: true},
+		{name: "本地版本号无效", local: "unknown", info: VersionInfo{Version: "1.3.0"}, want: true},
+		{name: "不在灰度范围内", local: "1.2.0", info: VersionInfo{Version: "1.3.0", Rollout: noRollout}, want: false},
+		{name: "紧急版本跳过灰度", local: "1.2.0", info: VersionInfo{Version: "1.3.0", Rollout: noRollout, Critical: true}, want: true},
+		{name: "低于最低版本跳过灰度", local: "1.2.0", info: VersionInfo{Version: "1.3.0", Rollout: noRollout, MinVersion: "1.2.5"}, want: true},
+		{name: "本地版本被禁止时跳过灰度", local: "1.2.0", info: VersionInfo{Version: "1.3.0", Rollout: noRollout, BlockedVersions: []string{"1.2.0"}}, want: true},
+		{name: "远程版本被禁止", local: "1.2.0", info: VersionInfo{Version: "1.3.0", BlockedVersions: []string{"v1.3.0"}}, want: false},
+		{name: "远程版本被禁止且读取本地版本失败", readErr: errors.New("not found"), info: VersionInfo{Version: "1.3.0", BlockedVersions: []string{"1.3.0"}}, want: false},
+		{name: "拒绝降级", local: "1.3.0", info: VersionInfo{Version: "1.2.0"}, want: false},
+		{name: "回滚", local: "1.3.0", info: VersionInfo{Version: "1.2.0", Rollback: true}, want: true},
+		{name: "本地版本被禁止时回滚", local: "1.3.0", info: VersionInfo{Version: "1.2.0", BlockedVersions: []string{"1.3.0"}}, want: true},
+		{name: "allow_downgrade", local: "1.3.0", info: VersionInfo{Version: "1.2.0"}, configure: func(cfg *Config) { cfg.AllowDowngrade = true }, want: true},
+		{name: "切换频道后降级", local: "1.3.0-beta.1", info: VersionInfo{Version: "1.2.0"}, configure: func(cfg *Config) { cfg.Channel = CHANNEL_BETA }, channel: CHANNEL_STABLE, want: true},
+		{name: "先行版本低于正式版本", local: "1.3.0-beta.1", info: VersionInfo{Version: "1.3.0"}, want: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u := newTestUpdater(t, func(cfg *Config) {
+				static(cfg)
+				if c.configure != nil {
+					c.configure(cfg)
+				}
+			})
+			if c.channel != "" {
+				if err := u.SetChannel(c.channel); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := u.needUpdate(c.local, c.readErr, &c.info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Fatalf("本地版本 %q 与远程版本 %s 的判断应为 %v，实际为 %v", c.local, c.info.Version, c.want, got)
+			}
+		})
+	}
+
+	u := newTestUpdater(t, static)
+	if _, err := u.needUpdate("1.2.0", nil, &VersionInfo{Version: "latest"}); err == nil {
+		t.Fatal("远程版本号无效时应返回错误")
+	}
+}
@@ -0,0 +1,69 @@
+package updater
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WatchConfig 在收到 SIGHUP 或配置文件修改时间变化时，通过 l 重新加载配置并提交给 Run，
+// 直到调用 Stop。轮询间隔取自 config_watch_interval，为 0 时只响应 SIGHUP
+func (u *Updater) WatchConfig(l *ConfigLoader) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	path, _ := l.ConfigPath()
+	lastMod := configModTime(path)
+	interval := time.Duration(u.Config().ConfigWatchInterval)
+
+	for {
+		var poll <-chan time.Time
+		var timer *time.Timer
+		if interval > 0 {
+			timer = time.NewTimer(interval)
+			poll = timer.C
+		}
+
+		select {
+		case <-u.stopCh:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-sigCh:
+			if timer != nil {
+				timer.Stop()
+			}
+			u.logf("收到 SIGHUP，重新加载配置")
+			lastMod = configModTime(path)
+		case <-poll:
+			mod := configModTime(path)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			u.logf("配置文件 %s 已修改，重新加载配置", path)
+		}
+
+		cfg, err := l.Load()
+		if err == nil {
+			err = u.Reload(cfg)
+		}
+		if err != nil {
+			u.logf("重新加载配置失败，继续使用当前配置: %v", err)
+			continue
+		}
+		interval = time.Duration(cfg.ConfigWatchInterval)
+	}
+}
+
+// configModTime 返回配置文件的修改时间，文件不存在时返回零值
+func configModTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}